@@ -6,4 +6,5 @@ go get -v github.com/mattn/goveralls
 go get -v github.com/lib/pq
 go get -v github.com/go-sql-driver/mysql
 go get -v github.com/jmoiron/sqlx
-go get -v github.com/mattn/go-sqlite3
\ No newline at end of file
+go get -v github.com/mattn/go-sqlite3go get -v gopkg.in/yaml.v3
+go get -v golang.org/x/tools/go/analysis/...
@@ -0,0 +1,304 @@
+package sqlx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ErrAdmissionTimeout is returned by BeginTxm and BeginTxmx when the
+// transaction waits for admission longer than Wait of its class.
+var ErrAdmissionTimeout = errors.New("sqlx: timed out waiting for admission of transaction")
+
+// Class is the limit of transactions which have the same label.
+// The label is given by WithLabel when the transaction begins.
+type Class struct {
+	// Weight is the number of slots which a transaction takes.
+	// Zero means 1.
+	Weight int
+	// Reserved is the number of slots which only the class can use,
+	// like for critical transactions during a burst of others.
+	Reserved int
+	// Max is the max number of slots which the class can use.
+	// Zero means no limit other than the admission.
+	Max int
+	// Wait is the max time to wait for admission. Zero means
+	// waiting until the context is done.
+	Wait time.Duration
+}
+
+// AdmissionStats are statistics of Admission, like sql.DBStats.
+type AdmissionStats struct {
+	// InUse is the number of slots taken by active transactions.
+	InUse int
+	// Active is the number of active transactions.
+	Active int
+	// Waiting is the number of transactions waiting for admission.
+	Waiting int
+	// WaitCount is the total number of transactions which waited.
+	WaitCount int64
+	// WaitDuration is the total time waited for admission.
+	WaitDuration time.Duration
+	// Canceled is the total number of transactions which gave up waiting
+	// by the context or Wait of the class.
+	Canceled int64
+
+	// Classes are statistics of each label which has a transaction.
+	// They are nil in Classes.
+	Classes map[string]AdmissionStats
+}
+
+// Admission limits transactions which are active at the same time, so a
+// burst of transactions does not take all connections of the pool and
+// starve statements outside of transactions.
+//
+// Only outermost transactions are admitted, and nested transactions join
+// them without waiting. Transactions wait in order of arrival in each
+// class, but a transaction which fits in free slots is admitted before
+// transactions of other classes which don't fit.
+type Admission struct {
+	limit int
+
+	mu      sync.Mutex
+	classes map[string]Class
+	used    map[string]int
+	inUse   int
+	queue   []*admissionWaiter
+	stats   map[string]*AdmissionStats
+}
+
+type admissionWaiter struct {
+	label  string
+	weight int
+	ready  chan struct{}
+	done   bool
+}
+
+// NewAdmission returns Admission which admits transactions
+// until they take limit slots. It can be shared by DBs.
+func NewAdmission(limit int) *Admission {
+	return &Admission{
+		limit:   limit,
+		classes: make(map[string]Class),
+		used:    make(map[string]int),
+		stats:   make(map[string]*AdmissionStats),
+	}
+}
+
+// SetClass sets the limit of transactions labeled label.
+// Transactions without classes take 1 slot.
+func (a *Admission) SetClass(label string, c Class) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.classes[label] = c
+	a.dispatch()
+}
+
+// admit waits for admission of the outermost transaction.
+func (db *DB) admit(ctx context.Context) (func(), error) {
+	if db.admission == nil {
+		return func() {}, nil
+	}
+	return db.admission.Acquire(ctx, LabelFromContext(ctx))
+}
+
+// SetAdmission sets the admission of transactions which are begun after this.
+// nil disables it.
+//
+// It is not safe to call SetAdmission concurrently with BeginTxm.
+func (db *DB) SetAdmission(a *Admission) {
+	db.admission = a
+}
+
+// Acquire waits until a transaction labeled label is admitted, and returns
+// the func to release its slots. BeginTxm and BeginTxmx call it, so it is
+// needed only to limit other work together with transactions.
+func (a *Admission) Acquire(ctx context.Context, label string) (func(), error) {
+	a.mu.Lock()
+	c := a.classes[label]
+	w := &admissionWaiter{label: label, weight: weight(c)}
+	if w.weight > a.capacity(label) {
+		a.mu.Unlock()
+		return nil, fmt.Errorf("sqlx: transaction of %q takes %d slots over the limit", label, w.weight)
+	}
+	if !a.queued(label) && a.fits(label, w.weight) {
+		a.admit(w)
+		a.mu.Unlock()
+		return a.releaser(w), nil
+	}
+	w.ready = make(chan struct{})
+	a.queue = append(a.queue, w)
+	a.stat(label).Waiting++
+	a.mu.Unlock()
+
+	start := time.Now()
+	var timeout <-chan time.Time
+	if c.Wait > 0 {
+		timer := time.NewTimer(c.Wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var err error
+	select {
+	case <-w.ready:
+		// ctx may be done at the same time.
+		err = ctx.Err()
+	case <-ctx.Done():
+		err = ctx.Err()
+	case <-timeout:
+		err = ErrAdmissionTimeout
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	s := a.stat(label)
+	s.WaitCount++
+	s.WaitDuration += time.Since(start)
+	if w.done {
+		if err == nil {
+			return a.releaser(w), nil
+		}
+		// Admitted while giving up, so the slots go to others.
+		a.leave(w)
+		s.Canceled++
+		a.dispatch()
+		return nil, err
+	}
+	for i, q := range a.queue {
+		if q == w {
+			a.queue = append(a.queue[:i], a.queue[i+1:]...)
+			break
+		}
+	}
+	s.Waiting--
+	s.Canceled++
+	// Transactions behind it may fit now.
+	a.dispatch()
+	return nil, err
+}
+
+// Stats returns statistics of the admission.
+func (a *Admission) Stats() AdmissionStats {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	total := AdmissionStats{Classes: make(map[string]AdmissionStats, len(a.stats))}
+	for label, s := range a.stats {
+		total.InUse += s.InUse
+		total.Active += s.Active
+		total.Waiting += s.Waiting
+		total.WaitCount += s.WaitCount
+		total.WaitDuration += s.WaitDuration
+		total.Canceled += s.Canceled
+		total.Classes[label] = *s
+	}
+	return total
+}
+
+func weight(c Class) int {
+	if c.Weight > 0 {
+		return c.Weight
+	}
+	return 1
+}
+
+func (a *Admission) stat(label string) *AdmissionStats {
+	s, ok := a.stats[label]
+	if !ok {
+		s = &AdmissionStats{}
+		a.stats[label] = s
+	}
+	return s
+}
+
+// queued reports whether transactions of label are waiting.
+func (a *Admission) queued(label string) bool {
+	for _, w := range a.queue {
+		if w.label == label {
+			return true
+		}
+	}
+	return false
+}
+
+// capacity returns the max number of slots which label can use.
+func (a *Admission) capacity(label string) int {
+	n := a.limit
+	for l, other := range a.classes {
+		if l != label {
+			n -= other.Reserved
+		}
+	}
+	if c := a.classes[label]; c.Max > 0 && c.Max < n {
+		n = c.Max
+	}
+	return n
+}
+
+// fits reports whether a transaction of label which takes n slots
+// can be admitted without taking slots reserved for other classes.
+func (a *Admission) fits(label string, n int) bool {
+	c := a.classes[label]
+	if c.Max > 0 && a.used[label]+n > c.Max {
+		return false
+	}
+	reserved := 0
+	for l, other := range a.classes {
+		if l != label && other.Reserved > a.used[l] {
+			reserved += other.Reserved - a.used[l]
+		}
+	}
+	return a.inUse+n+reserved <= a.limit
+}
+
+func (a *Admission) admit(w *admissionWaiter) {
+	w.done = true
+	a.inUse += w.weight
+	a.used[w.label] += w.weight
+	s := a.stat(w.label)
+	s.InUse += w.weight
+	s.Active++
+}
+
+// dispatch admits waiting transactions which fit in free slots.
+func (a *Admission) dispatch() {
+	blocked := make(map[string]bool)
+	queue := a.queue[:0]
+	for _, w := range a.queue {
+		if blocked[w.label] || !a.fits(w.label, w.weight) {
+			// Keep the order in the class.
+			blocked[w.label] = true
+			queue = append(queue, w)
+			continue
+		}
+		a.admit(w)
+		a.stat(w.label).Waiting--
+		close(w.ready)
+	}
+	for i := len(queue); i < len(a.queue); i++ {
+		a.queue[i] = nil
+	}
+	a.queue = queue
+}
+
+func (a *Admission) releaser(w *admissionWaiter) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			a.mu.Lock()
+			defer a.mu.Unlock()
+			a.leave(w)
+			a.dispatch()
+		})
+	}
+}
+
+// leave frees the slots of the admitted waiter.
+func (a *Admission) leave(w *admissionWaiter) {
+	a.inUse -= w.weight
+	a.used[w.label] -= w.weight
+	s := a.stat(w.label)
+	s.InUse -= w.weight
+	s.Active--
+}
@@ -0,0 +1,210 @@
+package sqlx
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAdmission(t *testing.T) {
+	if !TestSqlite {
+		t.Skip("Disabling SQLite tests")
+	}
+	// Transactions of a DB are nested, so DBs share the admission
+	// like handlers of a service.
+	a := NewAdmission(1)
+	path := filepath.Join(t.TempDir(), "admission.db")
+	dbs := make([]*DB, 2)
+	for i := range dbs {
+		dbs[i] = MustOpen("sqlite3", path)
+		defer dbs[i].Close()
+		dbs[i].SetAdmission(a)
+	}
+
+	tx, err := dbs[0].BeginTxmx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	nested := dbs[0].MustBeginTxm()
+	if err := nested.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := dbs[1].BeginTxmx(ctx, nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected DeadlineExceeded, but got %v", err)
+	}
+
+	began := make(chan error)
+	go func() {
+		tx, err := dbs[1].BeginTxmx(context.Background(), nil)
+		if err == nil {
+			err = tx.Commit()
+		}
+		began <- err
+	}()
+	waitFor(t, func() bool { return a.Stats().Waiting == 1 })
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-began; err != nil {
+		t.Fatal(err)
+	}
+
+	s := a.Stats()
+	if s.InUse != 0 || s.Active != 0 || s.Waiting != 0 {
+		t.Fatalf("all slots must be released: %+v", s)
+	}
+	if s.WaitCount != 2 || s.Canceled != 1 || s.WaitDuration < 20*time.Millisecond {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+}
+
+func TestAdmissionJoin(t *testing.T) {
+	if !TestSqlite {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := MustOpen("sqlite3", filepath.Join(t.TempDir(), "admission.db"))
+	defer db.Close()
+	a := NewAdmission(2)
+	a.SetClass("report", Class{Max: 1})
+	db.SetAdmission(a)
+	ctx := context.Background()
+
+	// The report waits for the slot of report.
+	release, err := a.Acquire(ctx, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	joined := make(chan *Txm, 1)
+	go func() {
+		tx, err := db.BeginTxmx(WithLabel(ctx, "report"), nil)
+		if err != nil {
+			t.Error(err)
+		}
+		joined <- tx
+	}()
+	waitFor(t, func() bool { return a.Stats().Waiting == 1 })
+
+	tx, err := db.BeginTxmx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	release()
+
+	// The transaction which began while waiting is joined.
+	report := <-joined
+	if report != tx {
+		t.Fatal("transaction which began while waiting for admission must be joined")
+	}
+	if err := report.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if s := a.Stats(); s.InUse != 0 || s.Active != 0 {
+		t.Fatalf("all slots must be released: %+v", s)
+	}
+}
+
+func TestAdmissionClasses(t *testing.T) {
+	a := NewAdmission(4)
+	a.SetClass("critical", Class{Reserved: 1})
+	a.SetClass("report", Class{Weight: 2, Max: 2, Wait: 10 * time.Millisecond})
+	ctx := context.Background()
+
+	report, err := a.Acquire(ctx, "report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Max of report is taken.
+	if _, err := a.Acquire(ctx, "report"); err != ErrAdmissionTimeout {
+		t.Fatalf("expected ErrAdmissionTimeout, but got %v", err)
+	}
+	// A slot is left for critical.
+	web, err := a.Acquire(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if _, err := a.Acquire(short, ""); err != context.DeadlineExceeded {
+		t.Fatalf("reserved slot must not be taken, but got %v", err)
+	}
+	critical, err := a.Acquire(ctx, "critical")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admitted := make(chan struct{})
+	go func() {
+		release, err := a.Acquire(ctx, "")
+		if err != nil {
+			t.Error(err)
+		}
+		release()
+		close(admitted)
+	}()
+	waitFor(t, func() bool { return a.Stats().Classes[""].Waiting == 1 })
+	report()
+	report() // released once
+	<-admitted
+
+	s := a.Stats()
+	if s.InUse != 2 || s.Active != 2 {
+		t.Fatalf("unexpected stats: %+v", s)
+	}
+	if c := s.Classes["report"]; c.Canceled != 1 || c.Active != 0 {
+		t.Fatalf("unexpected stats of report: %+v", c)
+	}
+	web()
+	critical()
+
+	a.SetClass("huge", Class{Weight: 4})
+	if _, err := a.Acquire(ctx, "huge"); err == nil {
+		t.Fatal("transaction over the capacity of the class must be error")
+	}
+}
+
+func TestAdmissionCanceledWhileAdmitted(t *testing.T) {
+	a := NewAdmission(1)
+	release, err := a.Acquire(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	acquired := make(chan error)
+	go func() {
+		release, err := a.Acquire(ctx, "")
+		if err == nil {
+			release()
+		}
+		acquired <- err
+	}()
+	waitFor(t, func() bool { return a.Stats().Waiting == 1 })
+	// The waiter may be admitted before it sees ctx is canceled.
+	cancel()
+	release()
+	if err := <-acquired; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	if s := a.Stats(); s.InUse != 0 || s.Active != 0 || s.Waiting != 0 || s.Canceled != 1 {
+		t.Fatalf("the slot must be released: %+v", s)
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,15 @@
+// Command txmcheck reports misuse of transactions of
+// github.com/Code-Hex/sqlx-transactionmanager.
+//
+//	txmcheck ./...
+//	go vet -vettool=$(which txmcheck) ./...
+package main
+
+import (
+	"github.com/Code-Hex/sqlx-transactionmanager/txmcheck"
+	"golang.org/x/tools/go/analysis/singlechecker"
+)
+
+func main() {
+	singlechecker.Main(txmcheck.Analyzer)
+}
@@ -0,0 +1,141 @@
+package sqlx
+
+import (
+	"context"
+	"sync"
+)
+
+// A transaction runs on a single connection. Statements of Txm are executed
+// one at a time even if Txm is shared by goroutines, and rows of Get and
+// Select are scanned before the next statement runs.
+//
+// Rows returned by Query, Queryx and NamedQuery hold the lock until they
+// are closed by Close, or by Next reaching the end, because drivers like
+// lib/pq cannot execute statements while rows are read. So don't execute
+// statements of the transaction while reading its rows in the same
+// goroutine, it waits until ctx is done. Read them by Select instead.
+// The row of QueryRow is not held, so scan it before the next statement.
+
+// acquire waits until other statements finish.
+func (t *Txm) acquire(ctx context.Context) error {
+	select {
+	case t.sem <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// tryAcquire acquires the lock if no statements are running.
+func (t *Txm) tryAcquire() bool {
+	select {
+	case t.sem <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (t *Txm) release() {
+	<-t.sem
+}
+
+// execute executes s holding the lock of statements.
+// It is the innermost handler of statements of the transaction.
+func (t *Txm) execute(ctx context.Context, s *Statement) error {
+	// If deferred statements fail, the error of QueryRow is returned by Commit.
+	if err := t.Flush(ctx); err != nil && s.Op != OpQueryRow {
+		return err
+	}
+	if err := t.acquire(ctx); err != nil {
+		if s.Op != OpQueryRow {
+			return err
+		}
+		// ctx is done, and the query reports it by the row.
+		return execute(ctx, txmExt{t}, s)
+	}
+	if s.Op != OpQuery && s.Op != OpNamedQuery {
+		defer t.release()
+		err := execute(ctx, txmExt{t}, s)
+		if err == nil && s.Op == OpExec {
+			t.trackSavepoint(s.Query)
+		}
+		return err
+	}
+	rctx := newRowsContext(ctx, t.release)
+	err := execute(rctx, txmExt{t}, s)
+	if err != nil || !rctx.watched() {
+		rctx.close()
+	}
+	return err
+}
+
+// rowsContext is the context of a query which returns rows.
+// *sql.Rows derives a context from it by context.WithCancel,
+// which cancels it when the rows are closed, and calls the stop
+// function of AfterFunc then. So the rows call closed at that time,
+// or when ctx is done, which closes the rows too.
+//
+// Done returns its own channel, otherwise context.WithCancel
+// registers the derived context to the parent instead of AfterFunc.
+type rowsContext struct {
+	context.Context
+	done   chan struct{}
+	stop   func() bool
+	closed func()
+	once   sync.Once
+
+	mu    sync.Mutex
+	watch bool
+}
+
+func newRowsContext(ctx context.Context, closed func()) *rowsContext {
+	c := &rowsContext{
+		Context: ctx,
+		done:    make(chan struct{}),
+		closed:  closed,
+	}
+	c.stop = context.AfterFunc(ctx, func() { close(c.done) })
+	return c
+}
+
+func (c *rowsContext) Done() <-chan struct{} { return c.done }
+
+func (c *rowsContext) Err() error {
+	select {
+	case <-c.done:
+		return c.Context.Err()
+	default:
+		return nil
+	}
+}
+
+// AfterFunc is called by context.WithCancel.
+func (c *rowsContext) AfterFunc(f func()) func() bool {
+	c.mu.Lock()
+	c.watch = true
+	c.mu.Unlock()
+	stop := context.AfterFunc(c.Context, func() {
+		c.close()
+		f()
+	})
+	return func() bool {
+		c.close()
+		return stop()
+	}
+}
+
+// watched reports whether closing of the rows is watched.
+// If not, the rows cannot tell it, and the caller closes c.
+func (c *rowsContext) watched() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.watch
+}
+
+func (c *rowsContext) close() {
+	c.once.Do(func() {
+		c.stop()
+		c.closed()
+	})
+}
@@ -0,0 +1,134 @@
+package sqlx
+
+import (
+	"context"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+type deferredStmt struct {
+	query string
+	args  []interface{}
+}
+
+// Defer queues the statement which is executed just before the transaction
+// is committed physically. Queued statements are executed in order, and
+// consecutive INSERTs of a single row into the same columns are coalesced
+// into multi-row INSERTs.
+//
+// Statements executed by methods of Txm flush queued statements before
+// executing, so reads in the transaction see deferred writes. Statements
+// executed by prepared statements or the embedded *sqlx.Tx do not.
+func (t *Txm) Defer(query string, args ...interface{}) {
+	t.mu.Lock()
+	first := len(t.deferred) == 0
+	t.deferred = append(t.deferred, deferredStmt{query: query, args: args})
+	t.mu.Unlock()
+	if first {
+		t.BeforeCommit(func(t *Txm) error {
+			return t.Flush(context.Background())
+		})
+	}
+}
+
+// Flush executes statements which are queued by Defer.
+// Once Flush fails, it returns the same error until the transaction ends,
+// so the transaction cannot be committed.
+func (t *Txm) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	stmts, err := t.deferred, t.deferErr
+	t.deferred = nil
+	t.mu.Unlock()
+	if err != nil || len(stmts) == 0 {
+		return err
+	}
+	if err := t.flush(ctx, stmts); err != nil {
+		t.mu.Lock()
+		t.deferErr = err
+		t.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (t *Txm) flush(ctx context.Context, stmts []deferredStmt) error {
+	for i := 0; i < len(stmts); {
+		ins, ok := parseInsert(stmts[i])
+		if !ok {
+			if _, err := t.ExecContext(ctx, stmts[i].query, stmts[i].args...); err != nil {
+				return err
+			}
+			i++
+			continue
+		}
+		rows := [][]interface{}{stmts[i].args}
+		for i++; i < len(stmts); i++ {
+			next, ok := parseInsert(stmts[i])
+			if !ok || next.head != ins.head || next.n != ins.n {
+				break
+			}
+			rows = append(rows, stmts[i].args)
+		}
+		if err := t.execInsert(ctx, ins, rows); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// execInsert executes rows by multi-row INSERTs under the limit of placeholders.
+func (t *Txm) execInsert(ctx context.Context, ins insert, rows [][]interface{}) error {
+	tuple := "(" + strings.TrimSuffix(strings.Repeat("?, ", ins.n), ", ") + ")"
+	n := t.Dialect().MaxParams() / ins.n
+	for len(rows) > 0 {
+		chunk := rows
+		if len(chunk) > n {
+			chunk = chunk[:n]
+		}
+		rows = rows[len(chunk):]
+
+		tuples := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*ins.n)
+		for i, row := range chunk {
+			tuples[i] = tuple
+			args = append(args, row...)
+		}
+		query := t.Rebind(ins.head + " VALUES " + strings.Join(tuples, ", "))
+		if _, err := t.ExecContext(ctx, query, args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insert is INSERT statement of a single row which can be coalesced.
+type insert struct {
+	head string // INSERT INTO table (columns)
+	n    int    // number of placeholders
+}
+
+var insertRe = regexp.MustCompile(`(?is)^\s*(INSERT\s+INTO\s+[^\s(]+\s*\([^()]*\))\s*VALUES\s*\(([^()]*)\)\s*;?\s*$`)
+
+// parseInsert parses INSERT statement whose values are only placeholders,
+// like "INSERT INTO person (first_name, email) VALUES (?, ?)" or "($1, $2)".
+func parseInsert(s deferredStmt) (insert, bool) {
+	m := insertRe.FindStringSubmatch(s.query)
+	if m == nil {
+		return insert{}, false
+	}
+	values := strings.Split(m[2], ",")
+	for i, v := range values {
+		v = strings.TrimSpace(v)
+		if v != "?" && v != "$"+strconv.Itoa(i+1) {
+			return insert{}, false
+		}
+	}
+	if len(values) != len(s.args) {
+		return insert{}, false
+	}
+	return insert{
+		head: strings.Join(strings.Fields(m[1]), " "),
+		n:    len(values),
+	}, true
+}
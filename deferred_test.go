@@ -0,0 +1,100 @@
+package sqlx
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestDefer(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		insert := tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		// More rows than the limit of placeholders of sqlite.
+		for i := 0; i < 500; i++ {
+			tx.Defer(insert, "Code", "Hex", fmt.Sprintf("%d@example.com", i))
+		}
+		tx.Defer(tx.Rebind("UPDATE person SET last_name = ? WHERE email = ?"), "Updated", "0@example.com")
+		if len(tx.deferred) != 501 {
+			t.Fatalf("statements must be deferred, but got %d", len(tx.deferred))
+		}
+
+		// Reads must see deferred writes.
+		var n int
+		if err := tx.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 500 {
+			t.Fatalf("expected 500 rows, but got %d", n)
+		}
+		var lastName string
+		if err := tx.Get(&lastName, tx.Rebind("SELECT last_name FROM person WHERE email = ?"), "0@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if lastName != "Updated" {
+			t.Fatal("deferred statements must be executed in order")
+		}
+
+		tx.Defer(insert, "Jason", "Moiron", "jmoiron@jmoiron.net")
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 501 {
+			t.Fatalf("deferred statements must be committed, but got %d rows", n)
+		}
+	})
+}
+
+func TestDeferError(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		tx.Defer(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Code", "Hex", "x00.x7f@gmail.com")
+		tx.Defer("INSERT INTO unknown (id) VALUES (1)")
+		if err := tx.Commit(); err == nil {
+			t.Fatal("expected error of deferred statement")
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Fatalf("transaction must be rolled back, but got %d rows", n)
+		}
+	})
+}
+
+func TestParseInsert(t *testing.T) {
+	cases := []struct {
+		query string
+		args  int
+		head  string
+		ok    bool
+	}{
+		{"INSERT INTO person (first_name, email) VALUES (?, ?)", 2, "INSERT INTO person (first_name, email)", true},
+		{"insert into person(first_name, email)\n\tvalues ($1, $2);", 2, "insert into person(first_name, email)", true},
+		{"INSERT INTO person (first_name, email) VALUES ($2, $1)", 2, "", false},
+		{"INSERT INTO person (first_name, added_at) VALUES (?, now())", 1, "", false},
+		{"INSERT INTO person (first_name) VALUES (?), (?)", 2, "", false},
+		{"INSERT INTO person (first_name) VALUES (?) ON CONFLICT DO NOTHING", 1, "", false},
+		{"INSERT INTO person (first_name) SELECT ?", 1, "", false},
+		{"UPDATE person SET first_name = ?", 1, "", false},
+	}
+	for _, c := range cases {
+		ins, ok := parseInsert(deferredStmt{query: c.query, args: make([]interface{}, c.args)})
+		if ok != c.ok || ins.head != c.head {
+			t.Errorf("parseInsert(%q) = %q, %v, want %q, %v", c.query, ins.head, ok, c.head, c.ok)
+		}
+	}
+}
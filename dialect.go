@@ -0,0 +1,13 @@
+package sqlx
+
+import "github.com/Code-Hex/sqlx-transactionmanager/dialect"
+
+// Dialect returns the dialect of the driver of db.
+func (db *DB) Dialect() dialect.Dialect {
+	return dialect.For(db.DriverName())
+}
+
+// Dialect returns the dialect of the driver of the transaction.
+func (t *Txm) Dialect() dialect.Dialect {
+	return dialect.For(t.DriverName())
+}
@@ -0,0 +1,185 @@
+// Package dialect abstracts differences of SQL between databases,
+// so features on top of github.com/Code-Hex/sqlx-transactionmanager
+// can be written once for every database.
+//
+// The dialect is selected from the driver name, the same as bindvars
+// of github.com/jmoiron/sqlx.
+//
+//	d := dialect.For(db.DriverName())
+//	query := dialect.Rebind(d, "INSERT INTO person (email) VALUES (?)"+
+//		d.OnConflict([]string{"email"}, nil))
+package dialect
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Dialect is SQL of a database.
+type Dialect interface {
+	// Name returns the name of the dialect, like "postgres".
+	Name() string
+	// BindType returns the bindvar type of github.com/jmoiron/sqlx.
+	BindType() int
+	// MaxParams returns the max number of placeholders in a statement.
+	MaxParams() int
+	// Returning reports whether INSERT supports RETURNING clause.
+	Returning() bool
+
+	// Savepoint returns the statement to create a savepoint.
+	Savepoint(name string) string
+	// ReleaseSavepoint returns the statement to release a savepoint.
+	ReleaseSavepoint(name string) string
+	// RollbackToSavepoint returns the statement to roll back to a savepoint.
+	RollbackToSavepoint(name string) string
+
+	// ForUpdate returns the clause which is appended to SELECT to lock rows.
+	// If skipLocked is true, rows locked by other transactions are skipped.
+	// It returns an empty string if the database does not lock rows.
+	ForUpdate(skipLocked bool) string
+	// OnConflict returns the clause which is appended to INSERT ... VALUES.
+	// When a row conflicts on the conflict columns, the update columns are
+	// overwritten by the inserted values. If update is empty, the row is
+	// left as it is, and the inserted row is not counted as affected.
+	OnConflict(conflict, update []string) string
+
+	// IsUniqueViolation reports whether err is caused by a unique constraint.
+	IsUniqueViolation(err error) bool
+	// IsRetryable reports whether the transaction which failed by err
+	// can be retried, like deadlocks and serialization failures.
+	IsRetryable(err error) bool
+}
+
+var (
+	mu       sync.RWMutex
+	dialects = map[string]Dialect{
+		"postgres":    Postgres,
+		"pgx":         Postgres,
+		"cockroach":   CockroachDB,
+		"cockroachdb": CockroachDB,
+		"mysql":       MySQL,
+		"sqlite3":     SQLite3,
+		"sqlite":      SQLite3,
+	}
+)
+
+// Register sets the dialect of driverName.
+// It is used for drivers which are not known, or to override them.
+func Register(driverName string, d Dialect) {
+	mu.Lock()
+	defer mu.Unlock()
+	dialects[driverName] = d
+}
+
+// Lookup returns the dialect of driverName if it is known.
+func Lookup(driverName string) (Dialect, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	d, ok := dialects[driverName]
+	return d, ok
+}
+
+// For returns the dialect of driverName. If the driver is not known,
+// it returns the dialect of standard SQL with bindvars of the driver.
+func For(driverName string) Dialect {
+	if d, ok := Lookup(driverName); ok {
+		return d
+	}
+	return standard{name: driverName, bindType: sqlx.BindType(driverName)}
+}
+
+// Rebind transforms a query from QUESTION to the bindvar type of d.
+func Rebind(d Dialect, query string) string {
+	return sqlx.Rebind(d.BindType(), query)
+}
+
+// Placeholder returns nth placeholder of d. n starts from 1.
+func Placeholder(d Dialect, n int) string {
+	switch d.BindType() {
+	case sqlx.DOLLAR:
+		return "$" + strconv.Itoa(n)
+	case sqlx.NAMED:
+		return ":arg" + strconv.Itoa(n)
+	case sqlx.AT:
+		return "@p" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// Quote quotes the identifier name for d, so names which are reserved
+// words or have uppercase letters can be used in statements. A qualified
+// name, like "public.person", is quoted for each part.
+func Quote(d Dialect, name string) string {
+	q := `"`
+	if _, ok := d.(mysql); ok {
+		q = "`"
+	}
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = q + strings.ReplaceAll(p, q, q+q) + q
+	}
+	return strings.Join(parts, ".")
+}
+
+// standard is SQL which is shared by most databases.
+type standard struct {
+	name     string
+	bindType int
+}
+
+func (s standard) Name() string        { return s.name }
+func (s standard) BindType() int       { return s.bindType }
+func (standard) MaxParams() int        { return 999 }
+func (standard) Returning() bool       { return false }
+func (standard) ForUpdate(bool) string { return " FOR UPDATE" }
+
+func (standard) Savepoint(name string) string {
+	return "SAVEPOINT " + name
+}
+
+func (standard) ReleaseSavepoint(name string) string {
+	return "RELEASE SAVEPOINT " + name
+}
+
+func (standard) RollbackToSavepoint(name string) string {
+	return "ROLLBACK TO SAVEPOINT " + name
+}
+
+// OnConflict returns ON CONFLICT clause of postgres, which is
+// also supported by sqlite and cockroachdb.
+func (standard) OnConflict(conflict, update []string) string {
+	clause := " ON CONFLICT"
+	if len(conflict) > 0 {
+		clause += " (" + join(conflict, "%s") + ")"
+	}
+	if len(update) == 0 {
+		return clause + " DO NOTHING"
+	}
+	return clause + " DO UPDATE SET " + join(update, "%[1]s = EXCLUDED.%[1]s")
+}
+
+func (standard) IsUniqueViolation(error) bool { return false }
+func (standard) IsRetryable(error) bool       { return false }
+
+// sqlState returns SQLSTATE of err which is returned by lib/pq or pgx.
+func sqlState(err error) string {
+	var e interface{ SQLState() string }
+	if errors.As(err, &e) {
+		return e.SQLState()
+	}
+	return ""
+}
+
+// join formats each column by format, and joins them by comma.
+func join(columns []string, format string) string {
+	s := make([]string, len(columns))
+	for i, c := range columns {
+		s[i] = fmt.Sprintf(format, c)
+	}
+	return strings.Join(s, ", ")
+}
@@ -0,0 +1,102 @@
+package dialect
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	mysqldriver "github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestFor(t *testing.T) {
+	cases := map[string]Dialect{
+		"postgres": Postgres,
+		"pgx":      Postgres,
+		"mysql":    MySQL,
+		"sqlite3":  SQLite3,
+	}
+	for name, want := range cases {
+		if got := For(name); got != want {
+			t.Errorf("For(%q) = %s, want %s", name, got.Name(), want.Name())
+		}
+	}
+
+	d := For("unknown")
+	if d.Name() != "unknown" || Rebind(d, "SELECT ?") != "SELECT ?" {
+		t.Fatal("unknown driver must use standard SQL with bindvars of the driver")
+	}
+
+	Register("crdb", CockroachDB)
+	if For("crdb") != CockroachDB {
+		t.Fatal("registered dialect must be used")
+	}
+}
+
+func TestOnConflict(t *testing.T) {
+	cases := []struct {
+		d                Dialect
+		conflict, update []string
+		want             string
+	}{
+		{Postgres, []string{"email"}, nil, " ON CONFLICT (email) DO NOTHING"},
+		{SQLite3, []string{"a", "b"}, []string{"c", "d"}, " ON CONFLICT (a, b) DO UPDATE SET c = EXCLUDED.c, d = EXCLUDED.d"},
+		{MySQL, []string{"email"}, nil, " ON DUPLICATE KEY UPDATE email = email"},
+		{MySQL, []string{"email"}, []string{"name"}, " ON DUPLICATE KEY UPDATE name = VALUES(name)"},
+	}
+	for _, c := range cases {
+		if got := c.d.OnConflict(c.conflict, c.update); got != c.want {
+			t.Errorf("%s: OnConflict(%v, %v) = %q, want %q", c.d.Name(), c.conflict, c.update, got, c.want)
+		}
+	}
+}
+
+func TestPlaceholder(t *testing.T) {
+	if got := Placeholder(Postgres, 2); got != "$2" {
+		t.Fatalf("expected $2, but got %s", got)
+	}
+	if got := Placeholder(MySQL, 2); got != "?" {
+		t.Fatalf("expected ?, but got %s", got)
+	}
+	if got := Rebind(Postgres, "SELECT ?, ?"); got != "SELECT $1, $2" {
+		t.Fatalf("unexpected rebind: %s", got)
+	}
+}
+
+func TestQuote(t *testing.T) {
+	if got := Quote(Postgres, `public.Order"s`); got != `"public"."Order""s"` {
+		t.Fatalf("unexpected quote: %s", got)
+	}
+	if got := Quote(MySQL, "order"); got != "`order`" {
+		t.Fatalf("unexpected quote: %s", got)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	wrap := func(err error) error { return fmt.Errorf("failed: %w", err) }
+	cases := []struct {
+		d         Dialect
+		err       error
+		unique    bool
+		retryable bool
+	}{
+		{Postgres, wrap(&pq.Error{Code: "23505"}), true, false},
+		{Postgres, wrap(&pq.Error{Code: "40P01"}), false, true},
+		{CockroachDB, wrap(&pq.Error{Code: "40P01"}), false, false},
+		{CockroachDB, wrap(&pq.Error{Code: "40001"}), false, true},
+		{MySQL, wrap(&mysqldriver.MySQLError{Number: 1062}), true, false},
+		{MySQL, wrap(&mysqldriver.MySQLError{Number: 1213}), false, true},
+		{MySQL, wrap(&pq.Error{Code: "23505"}), false, false},
+		{SQLite3, errors.New("UNIQUE constraint failed: person.email"), true, false},
+		{SQLite3, errors.New("database is locked"), false, true},
+		{SQLite3, nil, false, false},
+	}
+	for _, c := range cases {
+		if got := c.d.IsUniqueViolation(c.err); got != c.unique {
+			t.Errorf("%s: IsUniqueViolation(%v) = %v", c.d.Name(), c.err, got)
+		}
+		if got := c.d.IsRetryable(c.err); got != c.retryable {
+			t.Errorf("%s: IsRetryable(%v) = %v", c.d.Name(), c.err, got)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package dialect
+
+import (
+	"errors"
+	"reflect"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MySQL is the dialect of mysql. Row locks with SKIP LOCKED
+// require mysql 8.0 or later.
+var MySQL Dialect = mysql{standard{name: "mysql", bindType: sqlx.QUESTION}}
+
+type mysql struct{ standard }
+
+func (mysql) MaxParams() int { return 65535 }
+
+func (mysql) ForUpdate(skipLocked bool) string {
+	if skipLocked {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return " FOR UPDATE"
+}
+
+// OnConflict returns ON DUPLICATE KEY UPDATE clause. It is applied to any
+// unique key of the table. To leave the row as it is, the first conflict
+// column is assigned to itself, so it returns an empty string if both
+// conflict and update are empty.
+func (mysql) OnConflict(conflict, update []string) string {
+	if len(update) == 0 {
+		if len(conflict) == 0 {
+			return ""
+		}
+		return " ON DUPLICATE KEY UPDATE " + join(conflict[:1], "%[1]s = %[1]s")
+	}
+	return " ON DUPLICATE KEY UPDATE " + join(update, "%[1]s = VALUES(%[1]s)")
+}
+
+func (mysql) IsUniqueViolation(err error) bool {
+	return errorNumber(err) == 1062 // ER_DUP_ENTRY
+}
+
+func (mysql) IsRetryable(err error) bool {
+	switch errorNumber(err) {
+	case 1213, // ER_LOCK_DEADLOCK
+		1205: // ER_LOCK_WAIT_TIMEOUT
+		return true
+	}
+	return false
+}
+
+// errorNumber returns Number of *mysql.MySQLError of go-sql-driver/mysql
+// in the chain of err. The error has no methods to get it, so it is read
+// by reflection, and this package does not depend on the driver.
+func errorNumber(err error) uint16 {
+	for ; err != nil; err = errors.Unwrap(err) {
+		v := reflect.ValueOf(err)
+		if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+			continue
+		}
+		if v.Elem().Type().Name() != "MySQLError" {
+			continue
+		}
+		if n := v.Elem().FieldByName("Number"); n.Kind() == reflect.Uint16 {
+			return uint16(n.Uint())
+		}
+	}
+	return 0
+}
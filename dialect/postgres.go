@@ -0,0 +1,44 @@
+package dialect
+
+import "github.com/jmoiron/sqlx"
+
+// Postgres is the dialect of postgres. It is used for lib/pq and pgx.
+var Postgres Dialect = postgres{standard{name: "postgres", bindType: sqlx.DOLLAR}}
+
+// CockroachDB is the dialect of cockroachdb. It is the same as postgres
+// except errors to retry. cockroachdb is connected by drivers of postgres,
+// so register the name of the driver with CockroachDB by Register.
+var CockroachDB Dialect = cockroachDB{postgres{standard{name: "cockroachdb", bindType: sqlx.DOLLAR}}}
+
+type postgres struct{ standard }
+
+func (postgres) MaxParams() int  { return 65535 }
+func (postgres) Returning() bool { return true }
+
+func (postgres) ForUpdate(skipLocked bool) string {
+	if skipLocked {
+		return " FOR UPDATE SKIP LOCKED"
+	}
+	return " FOR UPDATE"
+}
+
+func (postgres) IsUniqueViolation(err error) bool {
+	return sqlState(err) == "23505" // unique_violation
+}
+
+func (postgres) IsRetryable(err error) bool {
+	switch sqlState(err) {
+	case "40001", // serialization_failure
+		"40P01": // deadlock_detected
+		return true
+	}
+	return false
+}
+
+type cockroachDB struct{ postgres }
+
+// IsRetryable reports whether err requires the client to retry
+// the transaction. cockroachdb reports every retry error as 40001.
+func (cockroachDB) IsRetryable(err error) bool {
+	return sqlState(err) == "40001"
+}
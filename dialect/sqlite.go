@@ -0,0 +1,38 @@
+package dialect
+
+import (
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// SQLite3 is the dialect of sqlite. It is used for mattn/go-sqlite3
+// and other drivers of sqlite.
+var SQLite3 Dialect = sqlite3{standard{name: "sqlite3", bindType: sqlx.QUESTION}}
+
+type sqlite3 struct{ standard }
+
+// MaxParams returns SQLITE_MAX_VARIABLE_NUMBER of sqlite before 3.32.0.
+func (sqlite3) MaxParams() int { return 999 }
+
+// ForUpdate returns an empty string because sqlite has no row locks.
+// Transactions read without locking others, and only one of them can
+// write at a time. A transaction which reads rows to update them must
+// take the write lock first, like BEGIN IMMEDIATE, by writing something.
+func (sqlite3) ForUpdate(bool) string { return "" }
+
+// Errors of sqlite are checked by messages, so this package
+// does not depend on the driver which requires cgo.
+
+func (sqlite3) IsUniqueViolation(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "UNIQUE constraint failed")
+}
+
+func (sqlite3) IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || // SQLITE_BUSY
+		strings.Contains(msg, "database table is locked") // SQLITE_LOCKED
+}
@@ -32,7 +32,7 @@ func loadDefaultFixture(db *sqlx.DB) {
 	// If you want to know about tx.Rebind, See http://jmoiron.github.io/sqlx/#bindvars
 	tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Jason", "Moiron", "jmoiron@jmoiron.net")
 	tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "John", "Doe", "johndoeDNE@gmail.net")
-	tx.Commit()
+	tx.Commit() //txmcheck:ignore
 }
 
 func Connect() *sqlx.DB {
@@ -5,6 +5,8 @@ import (
 	"strings"
 
 	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+	"github.com/Code-Hex/sqlx-transactionmanager/migrate/split"
 	osqlx "github.com/jmoiron/sqlx"
 )
 
@@ -54,9 +56,14 @@ drop table place;
 }
 
 func MultiExec(e osqlx.Execer, query string) {
-	stmts := strings.Split(query, ";\n")
-	if len(strings.Trim(stmts[len(stmts)-1], " \n\t\r")) == 0 {
-		stmts = stmts[:len(stmts)-1]
+	d := dialect.For("")
+	if n, ok := e.(interface{ DriverName() string }); ok {
+		d = dialect.For(n.DriverName())
+	}
+	stmts, err := split.Statements(d, query)
+	if err != nil {
+		fmt.Println(err, query)
+		return
 	}
 	for _, s := range stmts {
 		_, err := e.Exec(s)
@@ -0,0 +1,341 @@
+package faulty
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+	"github.com/jmoiron/sqlx"
+)
+
+// Prefix is prepended to the name of the inner driver.
+const Prefix = "faulty:"
+
+var (
+	mu        sync.Mutex
+	injectors = map[string]*Injector{}
+)
+
+// Name returns the name of the faulty driver which wraps inner driver.
+func Name(inner string) string {
+	return Prefix + inner
+}
+
+// Register registers the faulty driver as "faulty:<inner>" and returns
+// its injector. The inner driver must be registered before calling this.
+// Register can be called many times, it returns the same injector.
+//
+// The registered driver can be used with sqlx.Open so DB, Txm and
+// transaction blocks in the tm package can be tested with faults.
+// It has the same bindvars and dialect as the inner driver.
+func Register(inner string) (*Injector, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if inj, ok := injectors[inner]; ok {
+		return inj, nil
+	}
+	db, err := sql.Open(inner, "")
+	if err != nil {
+		return nil, err
+	}
+	d := db.Driver()
+	db.Close()
+
+	inj := newInjector()
+	sql.Register(Name(inner), &faultyDriver{inner: d, inj: inj})
+	sqlx.BindDriver(Name(inner), sqlx.BindType(inner))
+	dialect.Register(Name(inner), dialect.For(inner))
+	injectors[inner] = inj
+	return inj, nil
+}
+
+// MustRegister is like Register but panics if the inner driver is not found.
+func MustRegister(inner string) *Injector {
+	inj, err := Register(inner)
+	if err != nil {
+		panic(err)
+	}
+	return inj
+}
+
+type faultyDriver struct {
+	inner driver.Driver
+	inj   *Injector
+}
+
+func (d *faultyDriver) Open(name string) (driver.Conn, error) {
+	c, err := d.inner.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: c, inj: d.inj}, nil
+}
+
+func (d *faultyDriver) OpenConnector(name string) (driver.Connector, error) {
+	if dc, ok := d.inner.(driver.DriverContext); ok {
+		c, err := dc.OpenConnector(name)
+		if err != nil {
+			return nil, err
+		}
+		return &connector{inner: c, driver: d}, nil
+	}
+	return &connector{dsn: name, driver: d}, nil
+}
+
+type connector struct {
+	inner  driver.Connector
+	dsn    string
+	driver *faultyDriver
+}
+
+func (c *connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.inner == nil {
+		return c.driver.Open(c.dsn)
+	}
+	dc, err := c.inner.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &conn{Conn: dc, inj: c.driver.inj}, nil
+}
+
+func (c *connector) Driver() driver.Driver {
+	return c.driver
+}
+
+type conn struct {
+	driver.Conn
+	inj *Injector
+}
+
+func (c *conn) Prepare(query string) (driver.Stmt, error) {
+	return c.PrepareContext(context.Background(), query)
+}
+
+func (c *conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	r := c.inj.fault(OpPrepare, query)
+	if r != nil && !r.AfterApply {
+		return nil, r.err()
+	}
+	var (
+		s   driver.Stmt
+		err error
+	)
+	if pc, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		s, err = pc.PrepareContext(ctx, query)
+	} else {
+		s, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		s.Close()
+		return nil, r.err()
+	}
+	return &stmt{Stmt: s, inj: c.inj, query: query}, nil
+}
+
+func (c *conn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	r := c.inj.fault(OpBegin, "")
+	if r != nil && !r.AfterApply {
+		return nil, r.err()
+	}
+	var (
+		t   driver.Tx
+		err error
+	)
+	if bc, ok := c.Conn.(driver.ConnBeginTx); ok {
+		t, err = bc.BeginTx(ctx, opts)
+	} else {
+		t, err = c.Conn.Begin()
+	}
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		t.Rollback()
+		return nil, r.err()
+	}
+	return &tx{Tx: t, inj: c.inj}, nil
+}
+
+func (c *conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	var exec func() (driver.Result, error)
+	switch e := c.Conn.(type) {
+	case driver.ExecerContext:
+		exec = func() (driver.Result, error) { return e.ExecContext(ctx, query, args) }
+	case driver.Execer:
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		exec = func() (driver.Result, error) { return e.Exec(query, values) }
+	default:
+		return nil, driver.ErrSkip
+	}
+	return execWithFault(c.inj, query, exec)
+}
+
+func (c *conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	var run func() (driver.Rows, error)
+	switch q := c.Conn.(type) {
+	case driver.QueryerContext:
+		run = func() (driver.Rows, error) { return q.QueryContext(ctx, query, args) }
+	case driver.Queryer:
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		run = func() (driver.Rows, error) { return q.Query(query, values) }
+	default:
+		return nil, driver.ErrSkip
+	}
+	return queryWithFault(c.inj, query, run)
+}
+
+func (c *conn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+func (c *conn) ResetSession(ctx context.Context) error {
+	if r, ok := c.Conn.(driver.SessionResetter); ok {
+		return r.ResetSession(ctx)
+	}
+	return nil
+}
+
+func (c *conn) IsValid() bool {
+	if v, ok := c.Conn.(driver.Validator); ok {
+		return v.IsValid()
+	}
+	return true
+}
+
+func (c *conn) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+type tx struct {
+	driver.Tx
+	inj *Injector
+}
+
+func (t *tx) Commit() error {
+	r := t.inj.fault(OpCommit, "")
+	if r == nil {
+		return t.Tx.Commit()
+	}
+	if r.AfterApply {
+		t.Tx.Commit()
+	} else {
+		// Do not leave the transaction on the connection because
+		// database/sql returns it into the pool.
+		t.Tx.Rollback()
+	}
+	return r.err()
+}
+
+func (t *tx) Rollback() error {
+	r := t.inj.fault(OpRollback, "")
+	if r == nil {
+		return t.Tx.Rollback()
+	}
+	// The transaction is always rolled back for the same reason as Commit.
+	t.Tx.Rollback()
+	return r.err()
+}
+
+type stmt struct {
+	driver.Stmt
+	inj   *Injector
+	query string
+}
+
+func (s *stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return execWithFault(s.inj, s.query, func() (driver.Result, error) {
+		if e, ok := s.Stmt.(driver.StmtExecContext); ok {
+			return e.ExecContext(ctx, args)
+		}
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Exec(values)
+	})
+}
+
+func (s *stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return queryWithFault(s.inj, s.query, func() (driver.Rows, error) {
+		if q, ok := s.Stmt.(driver.StmtQueryContext); ok {
+			return q.QueryContext(ctx, args)
+		}
+		values, err := namedValuesToValues(args)
+		if err != nil {
+			return nil, err
+		}
+		return s.Stmt.Query(values)
+	})
+}
+
+func (s *stmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if nc, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return nc.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func execWithFault(inj *Injector, query string, exec func() (driver.Result, error)) (driver.Result, error) {
+	r := inj.fault(OpExec, query)
+	if r != nil && !r.AfterApply {
+		return nil, r.err()
+	}
+	res, err := exec()
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		return nil, r.err()
+	}
+	return res, nil
+}
+
+func queryWithFault(inj *Injector, query string, run func() (driver.Rows, error)) (driver.Rows, error) {
+	r := inj.fault(OpQuery, query)
+	if r != nil && !r.AfterApply {
+		return nil, r.err()
+	}
+	rows, err := run()
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		rows.Close()
+		return nil, r.err()
+	}
+	return rows, nil
+}
+
+func namedValuesToValues(args []driver.NamedValue) ([]driver.Value, error) {
+	values := make([]driver.Value, len(args))
+	for i, arg := range args {
+		if arg.Name != "" {
+			return nil, errors.New("faulty: inner driver does not support the use of Named Parameters")
+		}
+		values[i] = arg.Value
+	}
+	return values, nil
+}
@@ -0,0 +1,113 @@
+package faulty
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+var errDeadlock = errors.New("deadlock detected")
+
+func openDB(t *testing.T) (*sqlx.DB, *Injector) {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	inj := MustRegister("sqlite3")
+	inj.Reset()
+	db := sqlx.MustOpen(Name("sqlite3"), filepath.Join(t.TempDir(), "faulty.db"))
+	t.Cleanup(func() { db.Close() })
+	db.MustExec("CREATE TABLE person (first_name text, last_name text)")
+	return db, inj
+}
+
+func count(t *testing.T, db *sqlx.DB) int {
+	var n int
+	if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestCommitAfterApply(t *testing.T) {
+	db, inj := openDB(t)
+	inj.Add(Rule{Op: OpCommit, Nth: 1, AfterApply: true})
+
+	tx, err := db.BeginTxm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name) VALUES (?, ?)"), "Code", "Hex")
+	if err := tx.Commit(); err != driver.ErrBadConn {
+		t.Fatalf("expected driver.ErrBadConn, but got %v", err)
+	}
+	if n := count(t, db); n != 1 {
+		t.Fatalf("commit must be applied on the server, but got %d rows", n)
+	}
+	if n := inj.Fired(OpCommit); n != 1 {
+		t.Fatalf("expected 1 fault, but got %d", n)
+	}
+}
+
+func TestBeginBadConn(t *testing.T) {
+	db, inj := openDB(t)
+	inj.Add(Rule{Op: OpBegin})
+
+	err := tm.Runx(db, func(tx tm.Executorx) error {
+		t.Fatal("transaction block must not be called")
+		return nil
+	})
+	if err != driver.ErrBadConn {
+		t.Fatalf("expected driver.ErrBadConn, but got %v", err)
+	}
+}
+
+func TestNthStatement(t *testing.T) {
+	db, inj := openDB(t)
+	inj.Add(Rule{Op: OpExec, Nth: 2, Err: errDeadlock})
+
+	err := tm.Runx(db, func(tx tm.Executorx) error {
+		for i := 0; i < 3; i++ {
+			if _, err := tx.Exec(tx.Rebind("INSERT INTO person (first_name, last_name) VALUES (?, ?)"), "Code", "Hex"); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != errDeadlock {
+		t.Fatalf("expected deadlock error, but got %v", err)
+	}
+	if n := count(t, db); n != 0 {
+		t.Fatalf("transaction must be rolled back, but got %d rows", n)
+	}
+}
+
+func TestProbability(t *testing.T) {
+	db, inj := openDB(t)
+	inj.Seed(1)
+	inj.Add(Rule{
+		Op:          OpQuery,
+		Probability: 0.5,
+		Err:         errDeadlock,
+		Match:       func(query string) bool { return query == "SELECT 1" },
+	})
+
+	failed := 0
+	for i := 0; i < 100; i++ {
+		var n int
+		if err := db.Get(&n, "SELECT 1"); err == errDeadlock {
+			failed++
+		}
+	}
+	if failed == 0 || failed == 100 {
+		t.Fatalf("expected some faults at random, but got %d", failed)
+	}
+	if n := inj.Fired(OpQuery); n != failed {
+		t.Fatalf("expected %d faults, but got %d", failed, n)
+	}
+}
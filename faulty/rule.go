@@ -0,0 +1,158 @@
+package faulty
+
+import (
+	"database/sql/driver"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Op represents driver operations which can be failed by Rule.
+// It can be combined with bitwise OR.
+type Op uint
+
+const (
+	// OpBegin is for beginning a transaction.
+	OpBegin Op = 1 << iota
+	// OpCommit is for committing a transaction.
+	OpCommit
+	// OpRollback is for rolling back a transaction.
+	OpRollback
+	// OpExec is for executing a statement which does not return rows.
+	OpExec
+	// OpQuery is for executing a statement which returns rows.
+	OpQuery
+	// OpPrepare is for preparing a statement.
+	OpPrepare
+
+	// OpStatement is for executing any statement.
+	OpStatement = OpExec | OpQuery
+)
+
+// Rule describes when and how a driver operation is failed.
+//
+// A rule with Nth fires on the Nth matched call (1-based) only.
+// Otherwise it fires with Probability, and zero Probability means always.
+type Rule struct {
+	// Op is operations which this rule applies to.
+	Op Op
+	// Match reports whether the rule applies to the query.
+	// The query is empty for OpBegin, OpCommit and OpRollback.
+	// nil matches any query.
+	Match func(query string) bool
+	// Nth fires this rule on the Nth matched call only.
+	Nth int
+	// Probability fires this rule at random when Nth is zero.
+	Probability float64
+	// Times limits the number of fires. Zero means unlimited.
+	Times int
+	// Err is returned instead of the result of the operation.
+	// driver.ErrBadConn is used if it is nil.
+	Err error
+	// AfterApply performs the operation on the inner driver before
+	// failing it. For OpCommit this simulates that the server applied
+	// the commit but the client did not receive the reply.
+	AfterApply bool
+}
+
+type rule struct {
+	Rule
+	calls int
+	fired int
+}
+
+// Injector holds rules for the registered faulty driver.
+// It is safe for concurrent use.
+type Injector struct {
+	mu    sync.Mutex
+	rules []*rule
+	rand  *rand.Rand
+	fired map[Op]int
+}
+
+func newInjector() *Injector {
+	return &Injector{
+		rand:  rand.New(rand.NewSource(time.Now().UnixNano())),
+		fired: make(map[Op]int),
+	}
+}
+
+// Add adds rules to the injector.
+func (i *Injector) Add(rules ...Rule) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, r := range rules {
+		i.rules = append(i.rules, &rule{Rule: r})
+	}
+}
+
+// Reset removes all rules and counters.
+func (i *Injector) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rules = nil
+	i.fired = make(map[Op]int)
+}
+
+// Seed seeds the random source used by probabilistic rules
+// so that a chaos test can be reproduced.
+func (i *Injector) Seed(seed int64) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.rand = rand.New(rand.NewSource(seed))
+}
+
+// Fired returns the number of faults injected for op.
+func (i *Injector) Fired(op Op) int {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	n := 0
+	for o, c := range i.fired {
+		if o&op != 0 {
+			n += c
+		}
+	}
+	return n
+}
+
+// fault returns the rule which fires for this call or nil.
+func (i *Injector) fault(op Op, query string) *Rule {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, r := range i.rules {
+		if r.Op&op == 0 {
+			continue
+		}
+		if r.Match != nil && !r.Match(query) {
+			continue
+		}
+		r.calls++
+		if r.Times > 0 && r.fired >= r.Times {
+			continue
+		}
+		if !r.fires(i.rand) {
+			continue
+		}
+		r.fired++
+		i.fired[op]++
+		return &r.Rule
+	}
+	return nil
+}
+
+func (r *rule) fires(rnd *rand.Rand) bool {
+	if r.Nth > 0 {
+		return r.calls == r.Nth
+	}
+	if r.Probability <= 0 {
+		return true
+	}
+	return rnd.Float64() < r.Probability
+}
+
+func (r *Rule) err() error {
+	if r.Err != nil {
+		return r.Err
+	}
+	return driver.ErrBadConn
+}
@@ -0,0 +1,444 @@
+// Package fixtures inserts rows of tables which are written in YAML or
+// JSON files, so tests can declare the data they need. Combined with
+// a transaction which is rolled back after each test, tests don't see
+// rows of others.
+//
+// A file maps tables to their rows. A row can be labeled by "_label",
+// and other rows refer to its column by "@table.label.column":
+//
+//	person:
+//	  - _label: jason
+//	    first_name: Jason
+//	    email: jmoiron@jmoiron.net
+//	post:
+//	  - author_id: "@person.jason.id"
+//	    title: Hello
+//
+// If the referred column is not written in the row, like "id" above, it
+// is generated by the database and read after the row is inserted.
+// Tables are inserted in order of references, and rows of a table are
+// inserted in order of files. Strings beginning with "@@" are written
+// as strings beginning with "@".
+package fixtures
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/yaml.v3"
+)
+
+// LabelKey is the key of the label of a row.
+const LabelKey = "_label"
+
+// ErrImplicitCommit is returned by ResetSequence in a transaction on mysql.
+var ErrImplicitCommit = errors.New("fixtures: resetting AUTO_INCREMENT commits the transaction on mysql")
+
+// Executor is the transaction which fixtures are inserted in,
+// like *sqlx.Txm of github.com/Code-Hex/sqlx-transactionmanager.
+type Executor interface {
+	DriverName() string
+	Rebind(string) string
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	QueryRowxContext(context.Context, string, ...interface{}) *sqlx.Row
+}
+
+// Fixtures are rows of tables which are loaded from files.
+type Fixtures struct {
+	tables map[string][]*row
+	labels map[string]map[string]*row
+
+	mu sync.Mutex
+	// last is the copy which is inserted by the last Insert.
+	last *Fixtures
+}
+
+type row struct {
+	table  string
+	label  string
+	values map[string]interface{}
+	// generated is the column which is generated by the database
+	// and referred by other rows.
+	generated string
+	inserted  bool
+}
+
+type ref struct {
+	table, label, column string
+}
+
+// Load loads fixtures from files of fsys which match patterns of path.Match.
+// Files of .yml, .yaml and .json are loaded, and others are ignored.
+// If no pattern is given, files in the root directory are loaded.
+func Load(fsys fs.FS, patterns ...string) (*Fixtures, error) {
+	if len(patterns) == 0 {
+		patterns = []string{"*"}
+	}
+	f := &Fixtures{
+		tables: make(map[string][]*row),
+		labels: make(map[string]map[string]*row),
+	}
+	for _, pattern := range patterns {
+		names, err := fs.Glob(fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			b, err := fs.ReadFile(fsys, name)
+			if err != nil {
+				return nil, err
+			}
+			if err := f.parse(name, b); err != nil {
+				return nil, fmt.Errorf("fixtures: %s: %w", name, err)
+			}
+		}
+	}
+	if err := f.link(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *Fixtures) parse(name string, b []byte) error {
+	var tables map[string][]map[string]interface{}
+	switch path.Ext(name) {
+	case ".yml", ".yaml":
+		if err := yaml.Unmarshal(b, &tables); err != nil {
+			return err
+		}
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.UseNumber()
+		if err := dec.Decode(&tables); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+	names := make([]string, 0, len(tables))
+	for table := range tables {
+		names = append(names, table)
+	}
+	sort.Strings(names)
+	for _, table := range names {
+		for _, values := range tables[table] {
+			r := &row{table: table, values: values}
+			if label, ok := values[LabelKey]; ok {
+				r.label = fmt.Sprint(label)
+				delete(values, LabelKey)
+				if f.labels[table] == nil {
+					f.labels[table] = make(map[string]*row)
+				}
+				if _, dup := f.labels[table][r.label]; dup {
+					return fmt.Errorf("duplicate label %s.%s", table, r.label)
+				}
+				f.labels[table][r.label] = r
+			}
+			f.tables[table] = append(f.tables[table], r)
+		}
+	}
+	return nil
+}
+
+// link checks references and marks generated columns.
+func (f *Fixtures) link() error {
+	for _, rows := range f.tables {
+		for _, r := range rows {
+			for _, v := range r.values {
+				ref, ok := parseRef(v)
+				if !ok {
+					continue
+				}
+				target, err := f.lookup(ref)
+				if err != nil {
+					return err
+				}
+				if _, ok := target.values[ref.column]; ok {
+					continue
+				}
+				if target.generated != "" && target.generated != ref.column {
+					return fmt.Errorf("fixtures: %s.%s has generated columns %s and %s",
+						ref.table, ref.label, target.generated, ref.column)
+				}
+				target.generated = ref.column
+			}
+		}
+	}
+	return nil
+}
+
+func (f *Fixtures) lookup(ref ref) (*row, error) {
+	r, ok := f.labels[ref.table][ref.label]
+	if !ok {
+		return nil, fmt.Errorf("fixtures: unknown row %s.%s", ref.table, ref.label)
+	}
+	return r, nil
+}
+
+// parseRef parses "@table.label.column".
+func parseRef(v interface{}) (ref, bool) {
+	s, ok := v.(string)
+	if !ok || !strings.HasPrefix(s, "@") || strings.HasPrefix(s, "@@") {
+		return ref{}, false
+	}
+	parts := strings.SplitN(s[1:], ".", 3)
+	if len(parts) != 3 {
+		return ref{}, false
+	}
+	return ref{table: parts[0], label: parts[1], column: parts[2]}, true
+}
+
+// Tables returns names of tables in order of insertion. A table comes
+// after tables which its rows refer to. It returns an error if tables
+// refer to each other.
+func (f *Fixtures) Tables() ([]string, error) {
+	deps := make(map[string]map[string]bool)
+	names := make([]string, 0, len(f.tables))
+	for table, rows := range f.tables {
+		names = append(names, table)
+		deps[table] = make(map[string]bool)
+		for _, r := range rows {
+			for _, v := range r.values {
+				if ref, ok := parseRef(v); ok && ref.table != table {
+					deps[table][ref.table] = true
+				}
+			}
+		}
+	}
+	sort.Strings(names)
+
+	var (
+		order []string
+		state = make(map[string]int) // 1: visiting, 2: done
+		visit func(string) error
+	)
+	visit = func(table string) error {
+		switch state[table] {
+		case 1:
+			return fmt.Errorf("fixtures: tables refer to each other at %s", table)
+		case 2:
+			return nil
+		}
+		state[table] = 1
+		dep := make([]string, 0, len(deps[table]))
+		for d := range deps[table] {
+			dep = append(dep, d)
+		}
+		sort.Strings(dep)
+		for _, d := range dep {
+			if err := visit(d); err != nil {
+				return err
+			}
+		}
+		state[table] = 2
+		order = append(order, table)
+		return nil
+	}
+	for _, table := range names {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return order, nil
+}
+
+// Insert inserts rows in tx. It can be called for each transaction,
+// even concurrently, and Value returns generated columns of the last
+// Insert which succeeded.
+func (f *Fixtures) Insert(ctx context.Context, tx Executor) error {
+	tables, err := f.Tables()
+	if err != nil {
+		return err
+	}
+	// Generated columns differ between transactions, so rows are copied.
+	c := f.clone()
+	d := dialect.For(tx.DriverName())
+	for _, table := range tables {
+		for _, r := range c.tables[table] {
+			if err := c.insert(ctx, tx, d, r); err != nil {
+				return err
+			}
+		}
+	}
+	f.mu.Lock()
+	f.last = c
+	f.mu.Unlock()
+	return nil
+}
+
+// clone returns a copy of rows which are not inserted yet.
+func (f *Fixtures) clone() *Fixtures {
+	c := &Fixtures{
+		tables: make(map[string][]*row, len(f.tables)),
+		labels: make(map[string]map[string]*row, len(f.labels)),
+	}
+	for table, rows := range f.tables {
+		for _, r := range rows {
+			copied := *r
+			copied.values = make(map[string]interface{}, len(r.values)+1)
+			for k, v := range r.values {
+				copied.values[k] = v
+			}
+			c.tables[table] = append(c.tables[table], &copied)
+			if r.label != "" {
+				if c.labels[table] == nil {
+					c.labels[table] = make(map[string]*row)
+				}
+				c.labels[table][r.label] = &copied
+			}
+		}
+	}
+	return c
+}
+
+func (f *Fixtures) insert(ctx context.Context, tx Executor, d dialect.Dialect, r *row) error {
+	columns := make([]string, 0, len(r.values))
+	for c := range r.values {
+		columns = append(columns, c)
+	}
+	sort.Strings(columns)
+	args := make([]interface{}, len(columns))
+	for i, c := range columns {
+		v, err := f.value(r.values[c])
+		if err != nil {
+			return fmt.Errorf("fixtures: %s.%s: %w", r.table, c, err)
+		}
+		args[i] = v
+	}
+
+	query := "INSERT INTO " + r.table + " (" + strings.Join(columns, ", ") + ") VALUES (" +
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", ") + ")"
+	if len(columns) == 0 {
+		query = "INSERT INTO " + r.table + " DEFAULT VALUES"
+	}
+	switch {
+	case r.generated == "":
+		_, err := tx.ExecContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return fmt.Errorf("fixtures: %s: %w", r.table, err)
+		}
+	case d.Returning():
+		var id interface{}
+		if err := tx.QueryRowxContext(ctx, tx.Rebind(query+" RETURNING "+r.generated), args...).Scan(&id); err != nil {
+			return fmt.Errorf("fixtures: %s: %w", r.table, err)
+		}
+		r.values[r.generated] = id
+	default:
+		res, err := tx.ExecContext(ctx, tx.Rebind(query), args...)
+		if err != nil {
+			return fmt.Errorf("fixtures: %s: %w", r.table, err)
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return fmt.Errorf("fixtures: %s: %w", r.table, err)
+		}
+		r.values[r.generated] = id
+	}
+	r.inserted = true
+	return nil
+}
+
+// value returns the argument of v.
+func (f *Fixtures) value(v interface{}) (interface{}, error) {
+	if ref, ok := parseRef(v); ok {
+		target, err := f.lookup(ref)
+		if err != nil {
+			return nil, err
+		}
+		if !target.inserted {
+			return nil, fmt.Errorf("%s.%s is referred before it is inserted", ref.table, ref.label)
+		}
+		return f.value(target.values[ref.column])
+	}
+	switch v := v.(type) {
+	case string:
+		if strings.HasPrefix(v, "@@") {
+			return v[1:], nil
+		}
+		return v, nil
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return n, nil
+		}
+		return v.Float64()
+	case map[string]interface{}, []interface{}:
+		// Nested values are written as JSON, like json columns.
+		b, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return string(b), nil
+	}
+	return v, nil
+}
+
+// Value returns the value of column of the row labeled label in table.
+// Generated columns which are referred by other rows are set after Insert.
+func (f *Fixtures) Value(table, label, column string) (interface{}, bool) {
+	f.mu.Lock()
+	last := f.last
+	f.mu.Unlock()
+	if last != nil {
+		f = last
+	}
+	r, ok := f.labels[table][label]
+	if !ok {
+		return nil, false
+	}
+	v, ok := r.values[column]
+	if !ok {
+		return nil, false
+	}
+	v, err := f.value(v)
+	return v, err == nil
+}
+
+// ResetSequence sets the sequence of column in table to the max value
+// of the column, so rows inserted after fixtures which have explicit IDs
+// don't conflict with them. It resets the sequence of serial columns on
+// postgres, AUTO_INCREMENT on mysql and AUTOINCREMENT on sqlite.
+//
+// On mysql, ALTER TABLE commits the transaction implicitly, so it returns
+// ErrImplicitCommit for transactions. Pass the DB instead, after the
+// fixtures are committed.
+func ResetSequence(ctx context.Context, tx Executor, table, column string) error {
+	d := dialect.For(tx.DriverName())
+	t, c := dialect.Quote(d, table), dialect.Quote(d, column)
+	switch d {
+	case dialect.Postgres, dialect.CockroachDB:
+		// pg_get_serial_sequence parses the table name as SQL, but not the column.
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"SELECT setval(pg_get_serial_sequence($1, $2), COALESCE(MAX(%s), 0) + 1, false) FROM %s", c, t),
+			t, column)
+		return err
+	case dialect.MySQL:
+		if _, ok := tx.(interface{ Commit() error }); ok {
+			return ErrImplicitCommit
+		}
+		var max int64
+		if err := tx.QueryRowxContext(ctx, fmt.Sprintf("SELECT COALESCE(MAX(%s), 0) FROM %s", c, t)).Scan(&max); err != nil {
+			return err
+		}
+		_, err := tx.ExecContext(ctx, fmt.Sprintf("ALTER TABLE %s AUTO_INCREMENT = %d", t, max+1))
+		return err
+	case dialect.SQLite3:
+		// sqlite_sequence has rows of tables which have AUTOINCREMENT only.
+		_, err := tx.ExecContext(ctx, fmt.Sprintf(
+			"UPDATE sqlite_sequence SET seq = (SELECT COALESCE(MAX(%s), 0) FROM %s) WHERE name = ?", c, t),
+			table)
+		return err
+	}
+	return fmt.Errorf("fixtures: cannot reset sequence on %s", tx.DriverName())
+}
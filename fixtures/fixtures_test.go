@@ -0,0 +1,191 @@
+package fixtures
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"testing/fstest"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "fixtures.db")+"?_foreign_keys=1")
+	t.Cleanup(func() { db.Close() })
+	db.MustExec(`CREATE TABLE author (id integer PRIMARY KEY AUTOINCREMENT, name text NOT NULL)`)
+	db.MustExec(`CREATE TABLE post (id integer PRIMARY KEY AUTOINCREMENT, author_id integer NOT NULL REFERENCES author (id), title text NOT NULL, meta text)`)
+	db.MustExec(`CREATE TABLE comment (post_id integer NOT NULL REFERENCES post (id), parent text, body text NOT NULL)`)
+	return db
+}
+
+var files = fstest.MapFS{
+	"authors.yml": {Data: []byte(`
+author:
+  - _label: jason
+    name: Jason
+  - _label: john
+    id: 10
+    name: John
+`)},
+	"posts.json": {Data: []byte(`{
+	"post": [
+		{"_label": "hello", "author_id": "@author.jason.id", "title": "Hello", "meta": {"tags": ["go"]}},
+		{"author_id": "@author.john.id", "title": "@@mention"}
+	],
+	"comment": [
+		{"post_id": "@post.hello.id", "body": "first"},
+		{"post_id": "@post.hello.id", "body": "second"}
+	]
+}`)},
+	"README.md": {Data: []byte("ignored")},
+}
+
+func TestTables(t *testing.T) {
+	f, err := Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables, err := f.Tables()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"author", "post", "comment"}; !reflect.DeepEqual(tables, want) {
+		t.Fatalf("expected %v, but got %v", want, tables)
+	}
+
+	cyclic := fstest.MapFS{"a.yml": {Data: []byte(`
+a:
+  - {_label: x, b_id: "@b.y.id"}
+b:
+  - {_label: y, a_id: "@a.x.id"}
+`)}}
+	f, err = Load(cyclic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.Tables(); err == nil {
+		t.Fatal("tables which refer to each other must be error")
+	}
+	if _, err := Load(fstest.MapFS{"a.yml": {Data: []byte(`a: [{x: "@b.y.id"}]`)}}); err == nil {
+		t.Fatal("reference to unknown row must be error")
+	}
+}
+
+func TestInsert(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	f, err := Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	if err := f.Insert(ctx, tx); err != nil {
+		t.Fatal(err)
+	}
+	id, ok := f.Value("author", "jason", "id")
+	if !ok {
+		t.Fatal("generated id must be set")
+	}
+	var title, meta string
+	if err := tx.QueryRowx("SELECT title, meta FROM post WHERE author_id = ?", id).Scan(&title, &meta); err != nil {
+		t.Fatal(err)
+	}
+	if title != "Hello" || meta != `{"tags":["go"]}` {
+		t.Fatalf("unexpected post: %q, %q", title, meta)
+	}
+	if err := tx.QueryRowx("SELECT title FROM post WHERE author_id = 10").Scan(&title); err != nil {
+		t.Fatal(err)
+	}
+	if title != "@mention" {
+		t.Fatalf("unexpected title: %q", title)
+	}
+	var n int
+	if err := tx.Get(&n, "SELECT count(*) FROM comment c JOIN post p ON p.id = c.post_id WHERE p.title = 'Hello'"); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 comments, but got %d", n)
+	}
+
+	if err := ResetSequence(ctx, tx, "author", "id"); err != nil {
+		t.Fatal(err)
+	}
+	res := tx.MustExec("INSERT INTO author (name) VALUES ('Code')")
+	if next, _ := res.LastInsertId(); next != 11 {
+		t.Fatalf("sequence must be reset after max id, but got %d", next)
+	}
+}
+
+func TestInsertConcurrent(t *testing.T) {
+	ctx := context.Background()
+	f, err := Load(files)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dbs := []*sqlx.DB{openDB(t), openDB(t)}
+	// Generated ids differ between databases.
+	dbs[1].MustExec("INSERT INTO author (name) VALUES ('Code')")
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(dbs))
+	for i, db := range dbs {
+		wg.Add(1)
+		go func(i int, db *sqlx.DB) {
+			defer wg.Done()
+			tx := db.MustBeginTxm()
+			defer tx.Rollback()
+			errs[i] = f.Insert(ctx, tx)
+		}(i, db)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	id, ok := f.Value("author", "jason", "id")
+	if !ok || (id != int64(1) && id != int64(2)) {
+		t.Fatalf("unexpected id of the last Insert: %v", id)
+	}
+}
+
+func TestResetSequenceQuoted(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	db.MustExec(`CREATE TABLE "order" (id integer PRIMARY KEY AUTOINCREMENT)`)
+
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	tx.MustExec(`INSERT INTO "order" (id) VALUES (5)`)
+	tx.MustExec(`UPDATE sqlite_sequence SET seq = 0 WHERE name = 'order'`)
+	if err := ResetSequence(ctx, tx, "order", "id"); err != nil {
+		t.Fatal(err)
+	}
+	res := tx.MustExec(`INSERT INTO "order" DEFAULT VALUES`)
+	if next, _ := res.LastInsertId(); next != 6 {
+		t.Fatalf("sequence must be reset after max id, but got %d", next)
+	}
+}
+
+// mysqlTx pretends to be a transaction on mysql.
+type mysqlTx struct{ *sqlx.Txm }
+
+func (mysqlTx) DriverName() string { return "mysql" }
+
+func TestResetSequenceMySQLTx(t *testing.T) {
+	db := openDB(t)
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	if err := ResetSequence(context.Background(), mysqlTx{tx}, "author", "id"); err != ErrImplicitCommit {
+		t.Fatalf("expected ErrImplicitCommit, but got %v", err)
+	}
+}
@@ -0,0 +1,91 @@
+package sqlx
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+)
+
+// txGroup is goroutines which are started by Go.
+type txGroup struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+}
+
+// Go runs f in a new goroutine which shares the transaction. Statements
+// of goroutines are serialized on the connection of the transaction.
+//
+// The first error returned by f cancels ctx of other goroutines, and makes
+// the transaction rollback-only: the outermost Commit waits for all
+// goroutines, then rolls back and returns the error. The outermost
+// Rollback cancels ctx and waits for them too.
+//
+// A panic in f is recovered and recorded as *tm.PanicError like the
+// error of f, because nothing can recover it in the new goroutine.
+//
+// ctx is derived from the context which the transaction is begun with.
+// f must not commit or roll back the transaction.
+func (t *Txm) Go(f func(ctx context.Context, tx tm.Executorx) error) {
+	t.mu.Lock()
+	if t.group == nil {
+		parent := t.ctx
+		if parent == nil {
+			parent = context.Background()
+		}
+		ctx, cancel := context.WithCancel(parent)
+		t.group = &txGroup{ctx: ctx, cancel: cancel}
+		t.afterEnd = append(t.afterEnd, cancel)
+	}
+	g := t.group
+	g.wg.Add(1)
+	t.mu.Unlock()
+
+	go func() {
+		defer g.wg.Done()
+		if err := g.run(f, t); err != nil {
+			g.once.Do(func() {
+				g.err = err
+				g.cancel()
+			})
+		}
+	}()
+}
+
+// run runs f, and returns *tm.PanicError if f panics.
+func (g *txGroup) run(f func(ctx context.Context, tx tm.Executorx) error, t *Txm) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &tm.PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return f(g.ctx, t)
+}
+
+// Wait waits for all goroutines started by Go,
+// and returns the first error of them.
+func (t *Txm) Wait() error {
+	t.mu.Lock()
+	g := t.group
+	t.mu.Unlock()
+	if g == nil {
+		return nil
+	}
+	g.wg.Wait()
+	return g.err
+}
+
+// stopGroup cancels goroutines started by Go and waits for them.
+func (t *Txm) stopGroup() {
+	t.mu.Lock()
+	g := t.group
+	t.mu.Unlock()
+	if g != nil {
+		g.cancel()
+		g.wg.Wait()
+	}
+}
@@ -0,0 +1,111 @@
+package sqlx
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+	"github.com/pkg/errors"
+)
+
+func TestGo(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		insert := db.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		times := 10
+		for i := 0; i < times; i++ {
+			i := i
+			tx.Go(func(ctx context.Context, tx tm.Executorx) error {
+				_, err := tx.ExecContext(ctx, insert, "Code", "Hex", fmt.Sprintf("%d@example.com", i))
+				return err
+			})
+		}
+		// Commit waits for all goroutines.
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != times {
+			t.Fatalf("expected %d rows, but got %d", times, n)
+		}
+	})
+}
+
+func TestGoError(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		insert := db.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		tx.MustExec(insert, "Code", "Hex", "x00.x7f@gmail.com")
+
+		errFailed := errors.New("failed")
+		canceled := make(chan error, 1)
+		tx.Go(func(ctx context.Context, tx tm.Executorx) error {
+			// The sibling is canceled by the error.
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return ctx.Err()
+		})
+		tx.Go(func(ctx context.Context, tx tm.Executorx) error {
+			if _, err := tx.ExecContext(ctx, insert, "John", "Doe", "johndoeDNE@gmail.net"); err != nil {
+				return err
+			}
+			return errFailed
+		})
+
+		if err := tx.Commit(); err != errFailed {
+			t.Fatalf("expected errFailed, but got %v", err)
+		}
+		if err := <-canceled; err != context.Canceled {
+			t.Fatalf("expected context.Canceled, but got %v", err)
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Fatalf("transaction must be rolled back, but got %d rows", n)
+		}
+	})
+}
+
+func TestGoPanic(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		insert := db.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		tx.MustExec(insert, "Code", "Hex", "x00.x7f@gmail.com")
+
+		tx.Go(func(ctx context.Context, tx tm.Executorx) error {
+			panic("oops")
+		})
+
+		// The panic does not crash the process, and rolls back the transaction.
+		err = tx.Commit()
+		perr, ok := err.(*tm.PanicError)
+		if !ok || perr.Value != "oops" || len(perr.Stack) == 0 {
+			t.Fatalf("expected *tm.PanicError, but got %v", err)
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Fatalf("transaction must be rolled back, but got %d rows", n)
+		}
+	})
+}
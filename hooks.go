@@ -0,0 +1,91 @@
+package sqlx
+
+// BeforeCommit registers f which is called just before the transaction is
+// committed physically, that is when the outermost Commit is called.
+// f can execute statements in the transaction. If f returns error,
+// the transaction is rolled back and Commit returns the error.
+func (t *Txm) BeforeCommit(f func(*Txm) error) {
+	t.mu.Lock()
+	t.beforeCommit = append(t.beforeCommit, f)
+	t.mu.Unlock()
+}
+
+// AfterCommit registers f which is called after the transaction
+// is committed physically.
+func (t *Txm) AfterCommit(f func(*Txm)) {
+	t.mu.Lock()
+	t.afterCommit = append(t.afterCommit, f)
+	t.mu.Unlock()
+}
+
+// AfterRollback registers f which is called after the transaction is
+// rolled back physically, or failed to commit.
+func (t *Txm) AfterRollback(f func(*Txm)) {
+	t.mu.Lock()
+	t.afterRollback = append(t.afterRollback, f)
+	t.mu.Unlock()
+}
+
+// runBeforeCommit runs hooks in order of registration.
+// Hooks can register more hooks while running.
+func (t *Txm) runBeforeCommit() error {
+	for {
+		t.mu.Lock()
+		hooks := t.beforeCommit
+		t.beforeCommit = nil
+		t.mu.Unlock()
+		if len(hooks) == 0 {
+			return nil
+		}
+		for _, f := range hooks {
+			if err := f(t); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func (t *Txm) runAfterCommit() {
+	t.mu.Lock()
+	hooks := t.afterCommit
+	t.afterCommit, t.afterRollback = nil, nil
+	t.mu.Unlock()
+	t.Journal().finish("COMMIT")
+	for _, f := range hooks {
+		f(t)
+	}
+}
+
+func (t *Txm) runAfterRollback() {
+	t.mu.Lock()
+	hooks := t.afterRollback
+	t.afterCommit, t.afterRollback = nil, nil
+	t.mu.Unlock()
+	t.Journal().finish("ROLLBACK")
+	for _, f := range hooks {
+		f(t)
+	}
+}
+
+// runBeforeEnd runs hooks which need the connection of the transaction
+// before the transaction is committed or rolled back.
+func (t *Txm) runBeforeEnd() {
+	t.mu.Lock()
+	hooks := t.beforeEnd
+	t.beforeEnd = nil
+	t.mu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
+
+// runAfterEnd runs hooks after the transaction is committed or rolled back.
+func (t *Txm) runAfterEnd() {
+	t.mu.Lock()
+	hooks := t.afterEnd
+	t.afterEnd = nil
+	t.mu.Unlock()
+	for _, f := range hooks {
+		f()
+	}
+}
@@ -0,0 +1,110 @@
+package sqlx
+
+import (
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestBeforeCommit(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var calls []string
+		tx.BeforeCommit(func(tx *Txm) error {
+			calls = append(calls, "before")
+			// Hooks can join the transaction.
+			nested := db.MustBeginTxm()
+			nested.MustExec(nested.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Code", "Hex", "x00.x7f@gmail.com")
+			return nested.Commit()
+		})
+		tx.AfterCommit(func(*Txm) { calls = append(calls, "after") })
+		tx.AfterRollback(func(*Txm) { calls = append(calls, "rollback") })
+
+		// Nested commit must not run hooks.
+		nested := db.MustBeginTxm()
+		if err := nested.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if len(calls) != 0 {
+			t.Fatalf("hooks must not run on nested commit: %v", calls)
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if len(calls) != 2 || calls[0] != "before" || calls[1] != "after" {
+			t.Fatalf("unexpected calls of hooks: %v", calls)
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("statements of hooks must be committed, but got %d rows", n)
+		}
+	})
+}
+
+func TestBeforeCommitError(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Code", "Hex", "x00.x7f@gmail.com")
+
+		errFailed := errors.New("failed")
+		var committed, rollbacked bool
+		tx.BeforeCommit(func(*Txm) error { return errFailed })
+		tx.AfterCommit(func(*Txm) { committed = true })
+		tx.AfterRollback(func(*Txm) { rollbacked = true })
+
+		if err := tx.Commit(); err != errFailed {
+			t.Fatalf("expected error of hook, but got %v", err)
+		}
+		if committed || !rollbacked {
+			t.Fatal("transaction must be rolled back when hook fails")
+		}
+		if db.activeTx.has() {
+			t.Fatal("transaction must be finished")
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Fatalf("transaction must be rolled back, but got %d rows", n)
+		}
+	})
+}
+
+func TestBeforeCommitNestedRollback(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Code", "Hex", "x00.x7f@gmail.com")
+		tx.BeforeCommit(func(*Txm) error {
+			nested := db.MustBeginTxm()
+			return nested.Rollback()
+		})
+
+		if _, ok := tx.Commit().(*NestedCommitErr); !ok {
+			t.Fatal("expected NestedCommitErr when a hook rolls back")
+		}
+		if db.activeTx.has() {
+			t.Fatal("transaction must be finished")
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Fatalf("transaction must be rolled back, but got %d rows", n)
+		}
+	})
+}
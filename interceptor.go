@@ -0,0 +1,186 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"time"
+
+	sqlxx "github.com/jmoiron/sqlx"
+)
+
+// Op is the operation of a statement.
+type Op string
+
+// Operations which are seen by middlewares.
+const (
+	OpExec       Op = "Exec"
+	OpQuery      Op = "Query"
+	OpQueryRow   Op = "QueryRow"
+	OpGet        Op = "Get"
+	OpSelect     Op = "Select"
+	OpNamedExec  Op = "NamedExec"
+	OpNamedQuery Op = "NamedQuery"
+)
+
+// Statement is a statement which is executed by DB or Txm.
+// Middlewares can rewrite Query and Args before calling the next handler,
+// and see the result after it.
+type Statement struct {
+	Op    Op
+	Query string
+	// Args are arguments of the query. Named operations have
+	// the named argument, a struct or a map, as Args[0].
+	Args []interface{}
+	// Dest is the destination of Get and Select.
+	Dest interface{}
+	// Tx is the transaction which executes the statement.
+	// It is nil if the statement is executed by DB.
+	Tx *Txm
+
+	// Result is set by Exec and NamedExec.
+	Result sql.Result
+	// Rows is set by Query and NamedQuery.
+	Rows *sqlxx.Rows
+
+	// The row of QueryRow is not exposed, because it cannot be read
+	// without consuming it. Errors are reported by Scan of the row.
+	row  *sql.Row
+	rowx *sqlxx.Row
+	std  bool
+}
+
+// Handler executes a statement.
+type Handler func(ctx context.Context, s *Statement) error
+
+// Middleware wraps the handler of statements.
+type Middleware func(next Handler) Handler
+
+// Use appends middlewares which wrap every statement executed by methods
+// of db and transactions of db. The first middleware is the outermost.
+// Transactions which are already begun are not affected.
+//
+// It is not safe to call Use concurrently with executing statements.
+func (db *DB) Use(mws ...Middleware) {
+	db.middlewares = append(db.middlewares, mws...)
+	h := Handler(db.execute)
+	for i := len(db.middlewares) - 1; i >= 0; i-- {
+		h = db.middlewares[i](h)
+	}
+	db.handler = h
+}
+
+// execute is the innermost handler of middlewares.
+func (db *DB) execute(ctx context.Context, s *Statement) error {
+	if s.Tx != nil {
+		return s.Tx.execute(ctx, s)
+	}
+	return execute(ctx, db.DB, s)
+}
+
+func (db *DB) run(ctx context.Context, s *Statement) error {
+	if db.handler == nil {
+		return execute(ctx, db.DB, s)
+	}
+	return db.handler(ctx, s)
+}
+
+func (t *Txm) run(ctx context.Context, s *Statement) error {
+	if t.watch != nil {
+		defer t.watch.statement(s.Query)()
+	}
+	j := t.Journal()
+	if j == nil {
+		return t.handle(ctx, s)
+	}
+	savepoint := t.savepointLevel()
+	start := time.Now()
+	err := t.handle(ctx, s)
+	j.record(t, s, savepoint, time.Since(start), err)
+	return err
+}
+
+func (t *Txm) handle(ctx context.Context, s *Statement) error {
+	if t.handler == nil {
+		return t.execute(ctx, s)
+	}
+	return t.handler(ctx, s)
+}
+
+// queryer is the underlying DB or transaction which executes statements.
+type queryer interface {
+	sqlxx.ExtContext
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+func execute(ctx context.Context, q queryer, s *Statement) (err error) {
+	switch s.Op {
+	case OpExec:
+		s.Result, err = q.ExecContext(ctx, s.Query, s.Args...)
+	case OpQuery:
+		s.Rows, err = q.QueryxContext(ctx, s.Query, s.Args...)
+	case OpQueryRow:
+		if s.std {
+			s.row = q.QueryRowContext(ctx, s.Query, s.Args...)
+		} else {
+			s.rowx = q.QueryRowxContext(ctx, s.Query, s.Args...)
+		}
+	case OpGet:
+		err = sqlxx.GetContext(ctx, q, s.Dest, s.Query, s.Args...)
+	case OpSelect:
+		err = sqlxx.SelectContext(ctx, q, s.Dest, s.Query, s.Args...)
+	case OpNamedExec:
+		s.Result, err = sqlxx.NamedExecContext(ctx, q, s.Query, namedArg(s))
+	case OpNamedQuery:
+		s.Rows, err = sqlxx.NamedQueryContext(ctx, q, s.Query, namedArg(s))
+	default:
+		err = errors.New("sqlx: unknown operation " + string(s.Op))
+	}
+	return err
+}
+
+func namedArg(s *Statement) interface{} {
+	if len(s.Args) == 0 {
+		return nil
+	}
+	return s.Args[0]
+}
+
+// queryRow runs s of QueryRow. If middlewares fail,
+// it returns a row which reports the error by Scan.
+func queryRow(ctx context.Context, s *Statement, run Handler) {
+	if err := run(ctx, s); err != nil {
+		ctx := context.WithValue(context.Background(), errRowKey{}, err)
+		if s.std {
+			s.row = errDB.QueryRowContext(ctx, "")
+		} else {
+			s.rowx = errDB.QueryRowxContext(ctx, "")
+		}
+	}
+}
+
+// errDB makes rows which have an error, because *sql.Row and *sqlx.Row
+// cannot be made with an error outside of their packages.
+var errDB = sqlxx.NewDb(sql.OpenDB(errConnector{}), "")
+
+type errRowKey struct{}
+
+type errConnector struct{}
+
+func (errConnector) Connect(context.Context) (driver.Conn, error) { return errConn{}, nil }
+func (errConnector) Driver() driver.Driver                        { return errDriver{} }
+
+type errDriver struct{}
+
+func (errDriver) Open(string) (driver.Conn, error) { return errConn{}, nil }
+
+type errConn struct{}
+
+func (errConn) Prepare(string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (errConn) Close() error                        { return nil }
+func (errConn) Begin() (driver.Tx, error)           { return nil, driver.ErrSkip }
+
+func (errConn) QueryContext(ctx context.Context, _ string, _ []driver.NamedValue) (driver.Rows, error) {
+	return nil, ctx.Value(errRowKey{}).(error)
+}
@@ -0,0 +1,123 @@
+package sqlx
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func openInterceptedDB(t *testing.T) *DB {
+	if !TestSqlite {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := MustOpen("sqlite3", filepath.Join(t.TempDir(), "interceptor.db"))
+	t.Cleanup(func() { db.Close() })
+	db.MustExec("CREATE TABLE person (first_name text, last_name text, email text, added_at timestamp default current_timestamp)")
+	db.MustExec("CREATE TABLE secret (value text)")
+	return db
+}
+
+func TestInterceptor(t *testing.T) {
+	db := openInterceptedDB(t)
+
+	type call struct {
+		op   Op
+		tx   bool
+		rows int64
+	}
+	var calls []call
+	db.Use(
+		func(next Handler) Handler {
+			return func(ctx context.Context, s *Statement) error {
+				err := next(ctx, s)
+				c := call{op: s.Op, tx: s.Tx != nil}
+				if s.Result != nil {
+					c.rows, _ = s.Result.RowsAffected()
+				}
+				calls = append(calls, c)
+				return err
+			}
+		},
+		func(next Handler) Handler {
+			return func(ctx context.Context, s *Statement) error {
+				// Rewrite the query before the inner handler.
+				s.Query = strings.Replace(s.Query, "/* person */", "person", 1)
+				return next(ctx, s)
+			}
+		},
+	)
+
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	tx.MustExec("INSERT INTO /* person */ (first_name, last_name, email) VALUES (?, ?, ?)", "Code", "Hex", "x00.x7f@gmail.com")
+	if _, err := tx.NamedExec("INSERT INTO person (first_name, last_name, email) VALUES (:first_name, :last_name, :email)", &Person{
+		FirstName: "Jason",
+		LastName:  "Moiron",
+		Email:     "jmoiron@jmoiron.net",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	var people []Person
+	if err := tx.Select(&people, "SELECT * FROM person"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []call{
+		{op: OpExec, tx: true, rows: 1},
+		{op: OpNamedExec, tx: true, rows: 1},
+		{op: OpSelect, tx: true},
+		{op: OpGet},
+	}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %v, but got %v", want, calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("expected %v, but got %v", want[i], calls[i])
+		}
+	}
+	if len(people) != 2 || n != 2 {
+		t.Fatalf("unexpected results: %d people, count %d", len(people), n)
+	}
+}
+
+func TestInterceptorPolicy(t *testing.T) {
+	db := openInterceptedDB(t)
+	errDenied := errors.New("denied")
+	db.Use(func(next Handler) Handler {
+		return func(ctx context.Context, s *Statement) error {
+			if strings.Contains(s.Query, "secret") {
+				return errDenied
+			}
+			return next(ctx, s)
+		}
+	})
+
+	if _, err := db.Exec("INSERT INTO secret (value) VALUES ('x')"); err != errDenied {
+		t.Fatalf("expected errDenied, but got %v", err)
+	}
+	var value string
+	if err := db.QueryRow("SELECT value FROM secret").Scan(&value); err != errDenied {
+		t.Fatalf("row must report the error of middleware, but got %v", err)
+	}
+
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	if err := tx.QueryRowx("SELECT value FROM secret").Scan(&value); err != errDenied {
+		t.Fatalf("row must report the error of middleware, but got %v", err)
+	}
+	var n int
+	if err := tx.QueryRowx("SELECT count(*) FROM person").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+}
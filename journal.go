@@ -0,0 +1,250 @@
+package sqlx
+
+import (
+	"bufio"
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+// Redactor returns arguments which are recorded in the journal
+// instead of args of the query, to hide secrets and personal data.
+type Redactor func(query string, args []interface{}) []interface{}
+
+// JournalEntry is a statement recorded in the journal.
+type JournalEntry struct {
+	Op Op
+	// Query is the query which is executed. Named queries are recorded
+	// after their arguments are bound.
+	Query string
+	// Args are arguments after redaction.
+	Args     []interface{}
+	Duration time.Duration
+	// RowsAffected is the number of rows affected by Exec and
+	// NamedExec, or -1 for other operations.
+	RowsAffected int64
+	// Err is the error of the statement. Errors of QueryRow
+	// are reported by Scan, so they are not recorded.
+	Err error
+	// Savepoint is the number of savepoints which are active
+	// when the statement is executed.
+	Savepoint int
+}
+
+// Journal records statements executed in a transaction.
+type Journal struct {
+	redact Redactor
+
+	mu      sync.Mutex
+	entries []JournalEntry
+	end     string
+}
+
+// EnableJournal enables the journal of the transaction which records
+// every statement executed by methods of Txm, including deferred ones.
+// If redact is not nil, arguments are recorded after redact.
+// The journal is kept after the transaction ends, so it can be read
+// in AfterCommit and AfterRollback hooks.
+func (t *Txm) EnableJournal(redact Redactor) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.journal == nil {
+		t.journal = &Journal{redact: redact}
+	}
+}
+
+// EnableJournal enables the journal of transactions which are begun after this.
+//
+// It is not safe to call EnableJournal concurrently with BeginTxm.
+func (db *DB) EnableJournal(redact Redactor) {
+	db.journal = true
+	db.redact = redact
+}
+
+// Journal returns the journal of the transaction.
+// It returns nil if the journal is not enabled.
+func (t *Txm) Journal() *Journal {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.journal
+}
+
+func (j *Journal) record(t *Txm, s *Statement, savepoint int, d time.Duration, err error) {
+	query, args := s.Query, s.Args
+	if s.Op == OpNamedExec || s.Op == OpNamedQuery {
+		if q, a, err := t.BindNamed(s.Query, namedArg(s)); err == nil {
+			query, args = q, a
+		}
+	}
+	args = append([]interface{}(nil), args...)
+	if j.redact != nil {
+		args = j.redact(query, args)
+	}
+	rows := int64(-1)
+	if s.Result != nil && err == nil {
+		if n, err := s.Result.RowsAffected(); err == nil {
+			rows = n
+		}
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.entries = append(j.entries, JournalEntry{
+		Op:           s.Op,
+		Query:        query,
+		Args:         args,
+		Duration:     d,
+		RowsAffected: rows,
+		Err:          err,
+		Savepoint:    savepoint,
+	})
+}
+
+// finish records the end of the transaction, COMMIT or ROLLBACK.
+func (j *Journal) finish(end string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	j.end = end
+	j.mu.Unlock()
+}
+
+// Entries returns statements recorded in the journal.
+func (j *Journal) Entries() []JournalEntry {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return append([]JournalEntry(nil), j.entries...)
+}
+
+// WriteSQL writes the journal as a transcript of SQL which can be replayed
+// by a client of the database, like sqlite3 or psql. Arguments are inlined
+// into queries as literals of d, so the transcript recorded on postgres
+// can be replayed on sqlite as long as queries are portable.
+// Statements which failed are written as comments with their errors,
+// because they were not applied, and replaying them would abort the
+// transaction on postgres.
+func (j *Journal) WriteSQL(w io.Writer, d dialect.Dialect) error {
+	j.mu.Lock()
+	entries, end := j.entries, j.end
+	j.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	bw.WriteString("-- transcript recorded by github.com/Code-Hex/sqlx-transactionmanager\nBEGIN;\n")
+	for _, e := range entries {
+		query, err := inline(e.Query, e.Args, d)
+		if err != nil {
+			return err
+		}
+		query = strings.TrimRight(strings.TrimSpace(query), ";") + ";"
+		if e.Err != nil {
+			fmt.Fprintf(bw, "-- error: %s\n", strings.ReplaceAll(e.Err.Error(), "\n", " "))
+			query = "-- " + strings.ReplaceAll(query, "\n", "\n-- ")
+		}
+		fmt.Fprintf(bw, "%s\n", query)
+	}
+	if end != "" {
+		fmt.Fprintf(bw, "%s;\n", end)
+	}
+	return bw.Flush()
+}
+
+// inline replaces placeholders, ? or $n, in query with literals of args.
+func inline(query string, args []interface{}, d dialect.Dialect) (string, error) {
+	var (
+		b    strings.Builder
+		next int
+	)
+	arg := func(n int) (string, error) {
+		if n < 0 || n >= len(args) {
+			return "", fmt.Errorf("sqlx: missing argument %d of %q", n+1, query)
+		}
+		return literal(args[n], d)
+	}
+	for i := 0; i < len(query); i++ {
+		c := query[i]
+		switch {
+		case c == '\'' || c == '"' || c == '`':
+			// Copy quoted strings and identifiers as they are.
+			j := i + 1
+			for ; j < len(query); j++ {
+				if query[j] == c {
+					if j+1 < len(query) && query[j+1] == c {
+						j++
+						continue
+					}
+					break
+				}
+			}
+			if j >= len(query) {
+				j = len(query) - 1
+			}
+			b.WriteString(query[i : j+1])
+			i = j
+		case c == '?':
+			lit, err := arg(next)
+			if err != nil {
+				return "", err
+			}
+			next++
+			b.WriteString(lit)
+		case c == '$' && i+1 < len(query) && '0' <= query[i+1] && query[i+1] <= '9':
+			j := i + 1
+			for j < len(query) && '0' <= query[j] && query[j] <= '9' {
+				j++
+			}
+			n, _ := strconv.Atoi(query[i+1 : j])
+			lit, err := arg(n - 1)
+			if err != nil {
+				return "", err
+			}
+			b.WriteString(lit)
+			i = j - 1
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// literal returns v as a literal of SQL.
+func literal(v interface{}, d dialect.Dialect) (string, error) {
+	v, err := driver.DefaultParameterConverter.ConvertValue(v)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case nil:
+		return "NULL", nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case bool:
+		if v {
+			return "TRUE", nil
+		}
+		return "FALSE", nil
+	case []byte:
+		if d == dialect.Postgres || d == dialect.CockroachDB {
+			return `'\x` + hex.EncodeToString(v) + "'", nil
+		}
+		return "X'" + hex.EncodeToString(v) + "'", nil
+	case string:
+		return quote(v), nil
+	case time.Time:
+		return quote(v.Format("2006-01-02 15:04:05.999999999-07:00")), nil
+	}
+	return "", fmt.Errorf("sqlx: cannot write %T as literal", v)
+}
+
+func quote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,130 @@
+package sqlx
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+func TestJournal(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		ctx := context.Background()
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		tx.EnableJournal(func(query string, args []interface{}) []interface{} {
+			if strings.Contains(query, "email") && len(args) == 3 {
+				args[2] = "redacted@example.com"
+			}
+			return args
+		})
+
+		insert := tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		tx.MustExec(insert, "Code", "Hex", "x00.x7f@gmail.com")
+		tx.MustExec("SAVEPOINT sp1")
+		tx.MustExec(insert, "John", "O'Doe", "johndoeDNE@gmail.net")
+		// Failed statements are commented out in the transcript.
+		if _, err := tx.ExecContext(ctx, "INSERT INTO nothing\nVALUES (1)"); err == nil {
+			t.Fatal("insert must fail")
+		}
+		tx.MustExec("ROLLBACK TO SAVEPOINT sp1")
+		var n int
+		if err := tx.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("statements after savepoint must be rolled back, but got %d rows", n)
+		}
+
+		var entries []JournalEntry
+		tx.AfterCommit(func(tx *Txm) { entries = tx.Journal().Entries() })
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		wantOps := []Op{OpExec, OpExec, OpExec, OpExec, OpExec, OpGet}
+		wantSavepoints := []int{0, 0, 1, 1, 1, 1}
+		if len(entries) != len(wantOps) {
+			t.Fatalf("expected %d entries, but got %d", len(wantOps), len(entries))
+		}
+		for i, e := range entries {
+			if e.Op != wantOps[i] || e.Savepoint != wantSavepoints[i] {
+				t.Errorf("unexpected entry %d: %v at savepoint %d", i, e.Op, e.Savepoint)
+			}
+		}
+		if entries[0].RowsAffected != 1 || entries[5].RowsAffected != -1 {
+			t.Fatal("rows affected must be recorded")
+		}
+		if entries[0].Args[2] != "redacted@example.com" {
+			t.Fatalf("arguments must be redacted, but got %v", entries[0].Args)
+		}
+
+		var buf bytes.Buffer
+		if err := tx.Journal().WriteSQL(&buf, dialect.SQLite3); err != nil {
+			t.Fatal(err)
+		}
+		transcript := buf.String()
+		for _, want := range []string{
+			"BEGIN;\n",
+			"VALUES ('John', 'O''Doe', 'redacted@example.com');\n",
+			"-- INSERT INTO nothing\n-- VALUES (1);\n",
+			"ROLLBACK TO SAVEPOINT sp1;\n",
+			"COMMIT;\n",
+		} {
+			if !strings.Contains(transcript, want) {
+				t.Errorf("transcript must contain %q:\n%s", want, transcript)
+			}
+		}
+
+		if !TestSqlite {
+			return
+		}
+		// Replay the transcript on sqlite.
+		replay := MustOpen("sqlite3", filepath.Join(t.TempDir(), "replay.db"))
+		defer replay.Close()
+		create, _ := defaultSchema.Sqlite3()
+		MultiExec(replay, create)
+		replay.MustExec(transcript)
+		if err := replay.Get(&n, "SELECT count(*) FROM person WHERE email = 'redacted@example.com'"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("replayed transcript must have 1 row, but got %d", n)
+		}
+	})
+}
+
+func TestInline(t *testing.T) {
+	at := time.Date(2017, 12, 24, 10, 20, 30, 0, time.UTC)
+	cases := []struct {
+		query string
+		args  []interface{}
+		d     dialect.Dialect
+		want  string
+	}{
+		{"SELECT ?, ?, ?", []interface{}{1, "a'b", nil}, dialect.SQLite3, "SELECT 1, 'a''b', NULL"},
+		{"SELECT $2, $1", []interface{}{true, 1.5}, dialect.Postgres, "SELECT 1.5, TRUE"},
+		{"SELECT '?', \"$1\", ?", []interface{}{[]byte{0xde, 0xad}}, dialect.MySQL, "SELECT '?', \"$1\", X'dead'"},
+		{"SELECT $1", []interface{}{[]byte{0xde, 0xad}}, dialect.Postgres, `SELECT '\xdead'`},
+		{"SELECT ?", []interface{}{at}, dialect.SQLite3, "SELECT '2017-12-24 10:20:30+00:00'"},
+	}
+	for _, c := range cases {
+		got, err := inline(c.query, c.args, c.d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != c.want {
+			t.Errorf("inline(%q) = %q, want %q", c.query, got, c.want)
+		}
+	}
+	if _, err := inline("SELECT ?, ?", []interface{}{1}, dialect.SQLite3); err == nil {
+		t.Fatal("missing argument must be error")
+	}
+}
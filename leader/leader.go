@@ -0,0 +1,125 @@
+// Package leader elects a leader among instances of a service by
+// a session lock of the database which is connected through
+// github.com/Code-Hex/sqlx-transactionmanager.
+//
+// Only the instance which holds the named lock runs the lead callback.
+// The lock is renewed over the connection which holds it, and the
+// leadership is stopped when the connection is lost or ctx is done.
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+)
+
+// LeadFunc runs while the instance is the leader. ctx is canceled when
+// the leadership is lost, so it should return as soon as ctx is done.
+// Returning from LeadFunc steps down from the leadership.
+type LeadFunc func(ctx context.Context) error
+
+// StopFunc is called after LeadFunc returns. err is the reason to stop:
+// the error of LeadFunc, the error which lost the lock, or ctx.Err().
+// It is nil if LeadFunc returned nil by itself.
+type StopFunc func(err error)
+
+// Elector contends for the leadership of name.
+type Elector struct {
+	db   *sqlx.DB
+	name string
+
+	// RenewInterval is the interval to verify the lock over the
+	// connection which holds it. If the connection is dropped, the
+	// database releases the lock at once, so another instance may lead
+	// up to RenewInterval before this instance notices the loss.
+	RenewInterval time.Duration
+	// RetryInterval is the interval to try to take the lock
+	// while another instance is the leader.
+	RetryInterval time.Duration
+
+	mu     sync.Mutex
+	leader bool
+}
+
+// New returns Elector with default settings.
+func New(db *sqlx.DB, name string) *Elector {
+	return &Elector{
+		db:            db,
+		name:          name,
+		RenewInterval: 5 * time.Second,
+		RetryInterval: 5 * time.Second,
+	}
+}
+
+// IsLeader reports whether this instance is the leader now.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.leader
+}
+
+func (e *Elector) setLeader(leader bool) {
+	e.mu.Lock()
+	e.leader = leader
+	e.mu.Unlock()
+}
+
+// Run contends for the leadership until ctx is done, and runs lead while
+// this instance is the leader. stop is called each time the leadership
+// is stopped if it is not nil. Run returns ctx.Err().
+func (e *Elector) Run(ctx context.Context, lead LeadFunc, stop StopFunc) error {
+	for {
+		lock, err := e.db.TrySessionLock(ctx, e.name)
+		if err == nil && lock != nil {
+			err := e.lead(ctx, lock, lead)
+			if stop != nil {
+				stop(err)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(e.RetryInterval):
+		}
+	}
+}
+
+// lead runs lead while lock is held. It returns the reason to stop.
+func (e *Elector) lead(ctx context.Context, lock *sqlx.SessionLock, lead LeadFunc) error {
+	defer lock.Release()
+
+	leadCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	e.setLeader(true)
+	defer e.setLeader(false)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- lead(leadCtx)
+	}()
+
+	ticker := time.NewTicker(e.RenewInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case err := <-done:
+			return err
+		case <-ctx.Done():
+			cancel()
+			<-done
+			return ctx.Err()
+		case <-ticker.C:
+			if err := lock.Ping(ctx); err != nil {
+				// Stop the leader before releasing the lock,
+				// so two leaders never run at the same time
+				// in this process.
+				cancel()
+				<-done
+				return err
+			}
+		}
+	}
+}
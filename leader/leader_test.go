@@ -0,0 +1,105 @@
+package leader
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/faulty"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T, driverName string) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen(driverName, filepath.Join(t.TempDir(), "leader.db"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func newElector(db *sqlx.DB, name string) *Elector {
+	e := New(db, name)
+	e.RenewInterval = 10 * time.Millisecond
+	e.RetryInterval = 10 * time.Millisecond
+	return e
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestElectOneLeader(t *testing.T) {
+	db := openDB(t, "sqlite3")
+	lead := func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	defer cancel1()
+	e1 := newElector(db, "cron")
+	stopped := make(chan error, 1)
+	go e1.Run(ctx1, lead, func(err error) { stopped <- err })
+	waitFor(t, e1.IsLeader)
+
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	defer cancel2()
+	e2 := newElector(db, "cron")
+	go e2.Run(ctx2, lead, nil)
+	time.Sleep(50 * time.Millisecond)
+	if e2.IsLeader() {
+		t.Fatal("only one instance must be the leader")
+	}
+
+	cancel1()
+	if err := <-stopped; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	waitFor(t, e2.IsLeader)
+}
+
+func TestDetectLoss(t *testing.T) {
+	inj := faulty.MustRegister("sqlite3")
+	inj.Reset()
+	db := openDB(t, faulty.Name("sqlite3"))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e := newElector(db, "cron")
+	leading := make(chan struct{}, 1)
+	canceled := make(chan struct{}, 1)
+	stopped := make(chan error, 1)
+	go e.Run(ctx, func(ctx context.Context) error {
+		leading <- struct{}{}
+		<-ctx.Done()
+		canceled <- struct{}{}
+		return nil
+	}, func(err error) { stopped <- err })
+
+	<-leading
+	// The connection which holds the lock is dropped.
+	inj.Add(faulty.Rule{
+		Op:    faulty.OpQuery,
+		Match: func(query string) bool { return query == "SELECT 1" },
+		Times: 1,
+	})
+	<-canceled
+	if err := <-stopped; !errors.Is(err, driver.ErrBadConn) {
+		t.Fatalf("expected the error of connection, but got %v", err)
+	}
+	// The leadership is taken again after the loss.
+	<-leading
+}
@@ -0,0 +1,191 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"hash/fnv"
+	"strconv"
+	"sync"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+// LockKey hashes key into int64 which is used as the key of advisory locks.
+// The hash is the same for all dialects, so a lock taken by a service on
+// postgres and a lock taken by the same service on sqlite in tests
+// serialize the same keys.
+func LockKey(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64())
+}
+
+// lockName returns the name of lock for GET_LOCK of mysql.
+// It must be shorter than 64 characters.
+func lockName(id int64) string {
+	return "sqlx-transactionmanager:" + strconv.FormatInt(id, 10)
+}
+
+// AdvisoryLock takes an advisory lock which is scoped to the transaction.
+// It waits until the lock is available or ctx is done.
+// The lock is released when the transaction is committed or rolled back.
+//
+// It uses pg_advisory_xact_lock on postgres and GET_LOCK on mysql.
+// On mysql RELEASE_LOCK is run just before commit or rollback, so another
+// session may take the lock a moment before the commit becomes visible.
+// Other dialects, like sqlite3 and cockroachdb, use an in-process lock table,
+// so the lock serializes only transactions in the same process.
+func (t *Txm) AdvisoryLock(ctx context.Context, key string) error {
+	_, err := t.advisoryLock(ctx, key, true)
+	return err
+}
+
+// TryAdvisoryLock is like AdvisoryLock but does not wait.
+// It reports whether the lock is taken.
+func (t *Txm) TryAdvisoryLock(ctx context.Context, key string) (bool, error) {
+	return t.advisoryLock(ctx, key, false)
+}
+
+func (t *Txm) advisoryLock(ctx context.Context, key string, wait bool) (bool, error) {
+	id := LockKey(key)
+	t.mu.Lock()
+	_, held := t.held[id]
+	t.mu.Unlock()
+	if held {
+		return true, nil
+	}
+
+	var (
+		ok  bool
+		err error
+	)
+	switch t.Dialect() {
+	case dialect.Postgres:
+		ok, err = t.pgLock(ctx, id, wait)
+	case dialect.MySQL:
+		ok, err = t.mysqlLock(ctx, id, wait)
+	default:
+		ok, err = t.localLock(ctx, id, wait)
+	}
+	if err != nil || !ok {
+		return false, err
+	}
+
+	t.mu.Lock()
+	if t.held == nil {
+		t.held = make(map[int64]struct{})
+	}
+	t.held[id] = struct{}{}
+	t.mu.Unlock()
+	return true, nil
+}
+
+func (t *Txm) pgLock(ctx context.Context, id int64, wait bool) (bool, error) {
+	if err := t.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer t.release()
+	if wait {
+		_, err := t.Tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", id)
+		return err == nil, err
+	}
+	var ok bool
+	err := t.Tx.QueryRowContext(ctx, "SELECT pg_try_advisory_xact_lock($1)", id).Scan(&ok)
+	return ok, err
+}
+
+func (t *Txm) mysqlLock(ctx context.Context, id int64, wait bool) (bool, error) {
+	timeout := 0
+	if wait {
+		timeout = -1
+	}
+	name := lockName(id)
+	if err := t.acquire(ctx); err != nil {
+		return false, err
+	}
+	defer t.release()
+	var got sql.NullInt64
+	if err := t.Tx.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", name, timeout).Scan(&got); err != nil {
+		return false, err
+	}
+	if !got.Valid {
+		return false, errors.New("sqlx: failed to get lock " + name)
+	}
+	if got.Int64 != 1 {
+		return false, nil
+	}
+	// GET_LOCK is scoped to the session, so release it on
+	// the connection of the transaction before it ends.
+	t.mu.Lock()
+	t.beforeEnd = append(t.beforeEnd, func() {
+		// The connection which may still hold the lock is discarded.
+		if _, err := t.Tx.Exec("SELECT RELEASE_LOCK(?)", name); err != nil {
+			t.discardConn()
+		}
+	})
+	t.mu.Unlock()
+	return true, nil
+}
+
+func (t *Txm) localLock(ctx context.Context, id int64, wait bool) (bool, error) {
+	if wait {
+		if err := localLocks.lock(ctx, id); err != nil {
+			return false, err
+		}
+	} else if !localLocks.tryLock(id) {
+		return false, nil
+	}
+	t.mu.Lock()
+	t.afterEnd = append(t.afterEnd, func() {
+		localLocks.unlock(id)
+	})
+	t.mu.Unlock()
+	return true, nil
+}
+
+// localLocks is the in-process lock table for drivers
+// which do not have advisory locks.
+var localLocks = &lockTable{locks: map[int64]chan struct{}{}}
+
+type lockTable struct {
+	mu    sync.Mutex
+	locks map[int64]chan struct{}
+}
+
+func (l *lockTable) lock(ctx context.Context, id int64) error {
+	for {
+		l.mu.Lock()
+		released, ok := l.locks[id]
+		if !ok {
+			l.locks[id] = make(chan struct{})
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *lockTable) tryLock(id int64) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.locks[id]; ok {
+		return false
+	}
+	l.locks[id] = make(chan struct{})
+	return true
+}
+
+func (l *lockTable) unlock(id int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if released, ok := l.locks[id]; ok {
+		delete(l.locks, id)
+		close(released)
+	}
+}
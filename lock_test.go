@@ -0,0 +1,67 @@
+package sqlx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLockKey(t *testing.T) {
+	if LockKey("customer:1") != LockKey("customer:1") {
+		t.Fatal("LockKey must be stable")
+	}
+	if LockKey("customer:1") == LockKey("customer:2") {
+		t.Fatal("LockKey must differ for different keys")
+	}
+}
+
+func TestAdvisoryLock(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		ctx := context.Background()
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.AdvisoryLock(ctx, "customer:1"); err != nil {
+			t.Fatal(err)
+		}
+		// Locks are reentrant in the same transaction.
+		if ok, err := tx.TryAdvisoryLock(ctx, "customer:1"); err != nil || !ok {
+			t.Fatalf("failed to take the lock again: %v", err)
+		}
+
+		// The transaction which does not join the transaction of db.
+		otx, err := db.DB.Beginx()
+		if err != nil {
+			t.Fatal(err)
+		}
+		other := newTxm(otx, &activeTx{count: 1}, &rollbacked{})
+		defer other.Rollback()
+
+		if ok, err := other.TryAdvisoryLock(ctx, "customer:1"); err != nil || ok {
+			t.Fatalf("lock must be held by another transaction: %v", err)
+		}
+		if ok, err := other.TryAdvisoryLock(ctx, "customer:2"); err != nil || !ok {
+			t.Fatalf("failed to take another lock: %v", err)
+		}
+
+		locked := make(chan error, 1)
+		go func() {
+			ctx, cancel := context.WithTimeout(ctx, 10*time.Second)
+			defer cancel()
+			locked <- other.AdvisoryLock(ctx, "customer:1")
+		}()
+		select {
+		case err := <-locked:
+			t.Fatalf("AdvisoryLock must wait until the lock is released: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-locked; err != nil {
+			t.Fatalf("failed to take the released lock: %v", err)
+		}
+	})
+}
@@ -0,0 +1,36 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+)
+
+var (
+	_ tm.Manager     = (*DB)(nil)
+	_ tm.Manager     = (*Txm)(nil)
+	_ tm.Transaction = (*Txm)(nil)
+)
+
+// BeginManaged begins a transaction or joins the active transaction
+// like BeginTxmx. It implements tm.Manager, so transaction blocks of
+// the tm package participate in nested transaction of DB.
+func (db *DB) BeginManaged(ctx context.Context, opts *sql.TxOptions) (tm.Transaction, error) {
+	txm, err := db.BeginTxmx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return txm, nil
+}
+
+// BeginManaged joins the transaction as nested transaction.
+// It implements tm.Manager, so transaction blocks of the tm package
+// can be run in the transaction which is already began.
+func (t *Txm) BeginManaged(ctx context.Context, opts *sql.TxOptions) (tm.Transaction, error) {
+	if !t.active() {
+		return nil, sql.ErrTxDone
+	}
+	t.activeTx.increment()
+	return t, nil
+}
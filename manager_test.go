@@ -0,0 +1,72 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+	"github.com/pkg/errors"
+)
+
+func TestRunJoinsActiveTransaction(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tm.Runx(db, func(tx tm.Executorx) error {
+			_, err := tx.Exec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Code", "Hex", "x00.x7f@gmail.com")
+			return err
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if !tx.activeTx.has() {
+			t.Fatal("transaction block must not finish the outer transaction")
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		var author Person
+		if err := db.Get(&author, "SELECT * FROM person LIMIT 1"); err != sql.ErrNoRows {
+			t.Fatalf("transaction block must be rolled back with the outer transaction: %v", err)
+		}
+	})
+}
+
+func TestRunManagedWithTxm(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		errFailed := errors.New("failed")
+		err = tm.RunManaged(context.Background(), nil, tx, func(tx tm.Executorx) error {
+			tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Code", "Hex", "x00.x7f@gmail.com")
+			return errFailed
+		})
+		if err != errFailed {
+			t.Fatalf("expected error of transaction block, but got %v", err)
+		}
+		if db.rollbacked.times() != 1 {
+			t.Fatal("failed transaction block must mark the outer transaction as rollbacked")
+		}
+
+		func() {
+			defer func() {
+				if _, ok := recover().(*NestedCommitErr); !ok {
+					t.Fatal("expected NestedCommitErr")
+				}
+			}()
+			tx.Commit()
+		}()
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+		if db.activeTx.has() || db.rollbacked.already() {
+			t.Fatalf("counters must be reset: active tx(%d), rollbacked(%d)", db.activeTx.get(), db.rollbacked.times())
+		}
+	})
+}
@@ -0,0 +1,291 @@
+// Package migrate applies schema migrations through the transaction
+// manager of github.com/Code-Hex/sqlx-transactionmanager.
+//
+// Migrations are numbered SQL files in fs.FS:
+//
+//	0001_create_person.up.sql
+//	0001_create_person.down.sql
+//	0002_add_email_index.up.sql
+//
+// Each migration is applied in its own transaction with the row of its
+// version in the versions table. A migration which cannot run in a
+// transaction, like CREATE INDEX CONCURRENTLY of postgres, starts with
+// the NoTransaction directive:
+//
+//	-- migrate:no-transaction
+//	CREATE INDEX CONCURRENTLY person_email ON person (email);
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/migrate/split"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+)
+
+// NoTransaction is the directive of a migration which is not applied
+// in a transaction. It must be in comment lines at the top of the file.
+const NoTransaction = "-- migrate:no-transaction"
+
+// Migration is a migration loaded from files.
+type Migration struct {
+	Version int64
+	Name    string
+	// Up and Down are scripts to apply and revert the migration.
+	// Down is empty if the migration has no down file.
+	Up, Down string
+}
+
+var fileRe = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Load loads migrations in the root directory of fsys in order of version.
+// Files which don't match the name of migrations are ignored.
+func Load(fsys fs.FS) ([]*Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := make(map[int64]*Migration)
+	for _, e := range entries {
+		m := fileRe.FindStringSubmatch(e.Name())
+		if e.IsDir() || m == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %w", e.Name(), err)
+		}
+		b, err := fs.ReadFile(fsys, e.Name())
+		if err != nil {
+			return nil, err
+		}
+		mig, ok := byVersion[version]
+		if !ok {
+			mig = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = mig
+		} else if mig.Name != m[2] {
+			return nil, fmt.Errorf("migrate: version %d is used by %q and %q", version, mig.Name, m[2])
+		}
+		if m[3] == "up" {
+			mig.Up = string(b)
+		} else {
+			mig.Down = string(b)
+		}
+	}
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, mig := range byVersion {
+		if mig.Up == "" {
+			return nil, fmt.Errorf("migrate: version %d has no up file", mig.Version)
+		}
+		migrations = append(migrations, mig)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// noTransaction reports whether script has the NoTransaction directive.
+func noTransaction(script string) bool {
+	for _, line := range strings.Split(script, "\n") {
+		line = strings.TrimSpace(line)
+		if line == NoTransaction {
+			return true
+		}
+		if line != "" && !strings.HasPrefix(line, "--") {
+			return false
+		}
+	}
+	return false
+}
+
+// Migrator applies migrations to DB.
+//
+// Migrators of many processes can run at the same time, like rolling
+// deploys, because a migrator takes an advisory lock on a session
+// while it applies migrations.
+type Migrator struct {
+	db   *sqlx.DB
+	fsys fs.FS
+
+	// Table is the name of the versions table.
+	Table string
+	// DryRun makes the migrator write statements to Log instead of
+	// executing them. The versions table is not created in dry-run.
+	DryRun bool
+	// Log is written applied migrations if not nil.
+	Log io.Writer
+}
+
+// New returns Migrator of migrations in fsys with default settings.
+func New(db *sqlx.DB, fsys fs.FS) *Migrator {
+	return &Migrator{
+		db:    db,
+		fsys:  fsys,
+		Table: "schema_migrations",
+	}
+}
+
+// Up applies migrations which are not applied yet in order of version.
+// It returns the number of applied migrations.
+func (m *Migrator) Up(ctx context.Context) (int, error) {
+	migrations, err := Load(m.fsys)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = m.locked(ctx, func(applied map[int64]bool) error {
+		for _, mig := range migrations {
+			if applied[mig.Version] {
+				continue
+			}
+			if err := m.apply(ctx, mig, true); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Down reverts the last applied migrations up to steps.
+// It returns the number of reverted migrations.
+func (m *Migrator) Down(ctx context.Context, steps int) (int, error) {
+	migrations, err := Load(m.fsys)
+	if err != nil {
+		return 0, err
+	}
+	n := 0
+	err = m.locked(ctx, func(applied map[int64]bool) error {
+		for i := len(migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := migrations[i]
+			if !applied[mig.Version] {
+				continue
+			}
+			if mig.Down == "" {
+				return fmt.Errorf("migrate: version %d has no down file", mig.Version)
+			}
+			if err := m.apply(ctx, mig, false); err != nil {
+				return err
+			}
+			n++
+		}
+		return nil
+	})
+	return n, err
+}
+
+// Applied returns versions of applied migrations in order.
+func (m *Migrator) Applied(ctx context.Context) ([]int64, error) {
+	var versions []int64
+	err := m.db.SelectContext(ctx, &versions, "SELECT version FROM "+m.Table+" ORDER BY version")
+	return versions, err
+}
+
+// locked runs f with applied versions while it holds the lock of migrations.
+func (m *Migrator) locked(ctx context.Context, f func(applied map[int64]bool) error) error {
+	lock, err := m.db.SessionLock(ctx, "migrate:"+m.Table)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	if !m.DryRun {
+		if _, err := m.db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.Table+
+			" (version bigint NOT NULL PRIMARY KEY, name varchar(255) NOT NULL, applied_at timestamp NOT NULL)"); err != nil {
+			return err
+		}
+	}
+	versions, err := m.Applied(ctx)
+	if err != nil && !m.DryRun {
+		return err
+	}
+	// In dry-run, the versions table may not exist yet.
+	applied := make(map[int64]bool, len(versions))
+	for _, v := range versions {
+		applied[v] = true
+	}
+	return f(applied)
+}
+
+func (m *Migrator) apply(ctx context.Context, mig *Migration, up bool) error {
+	script, direction := mig.Up, "up"
+	if !up {
+		script, direction = mig.Down, "down"
+	}
+	stmts, err := split.Statements(m.db.Dialect(), script)
+	if err != nil {
+		return fmt.Errorf("migrate: %d_%s.%s.sql: %w", mig.Version, mig.Name, direction, err)
+	}
+	m.logf("-- %d_%s (%s)\n", mig.Version, mig.Name, direction)
+	if m.DryRun {
+		for _, stmt := range stmts {
+			m.logf("%s;\n", stmt)
+		}
+		return nil
+	}
+
+	exec := func(ctx context.Context, e execer) error {
+		for i, stmt := range stmts {
+			if _, err := e.ExecContext(ctx, stmt); err != nil {
+				return &Error{Version: mig.Version, Name: mig.Name, Statement: i, Err: err}
+			}
+		}
+		var err error
+		if up {
+			_, err = e.ExecContext(ctx, m.db.Rebind("INSERT INTO "+m.Table+" (version, name, applied_at) VALUES (?, ?, ?)"),
+				mig.Version, mig.Name, time.Now().UTC())
+		} else {
+			_, err = e.ExecContext(ctx, m.db.Rebind("DELETE FROM "+m.Table+" WHERE version = ?"), mig.Version)
+		}
+		return err
+	}
+	if noTransaction(script) {
+		return exec(ctx, m.db)
+	}
+	// The migration must not join the active transaction of the app,
+	// but runs through middlewares, hooks and the journal of db.
+	return tm.RunxWithContext(ctx, nil, m.db.Detach(), func(tx tm.Executorx) error {
+		return exec(ctx, tx)
+	})
+}
+
+// execer is *sqlx.DB or the transaction.
+type execer interface {
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+}
+
+func (m *Migrator) logf(format string, args ...interface{}) {
+	if m.Log != nil {
+		fmt.Fprintf(m.Log, format, args...)
+	}
+}
+
+// Error is returned when a statement of a migration fails.
+type Error struct {
+	Version int64
+	Name    string
+	// Statement is the index of the failed statement in the script.
+	Statement int
+	Err       error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("migrate: %d_%s: statement %d: %v", e.Version, e.Name, e.Statement+1, e.Err)
+}
+
+// Unwrap returns the error of the statement.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
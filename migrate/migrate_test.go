@@ -0,0 +1,180 @@
+package migrate
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "migrate.db"))
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+var migrations = fstest.MapFS{
+	"0001_create_person.up.sql": {Data: []byte(`
+CREATE TABLE person (id integer PRIMARY KEY, name text NOT NULL);
+CREATE TABLE audit (message text);
+CREATE TRIGGER person_audit AFTER INSERT ON person BEGIN
+	INSERT INTO audit (message) VALUES ('inserted; ' || NEW.name);
+END;
+`)},
+	"0001_create_person.down.sql": {Data: []byte("DROP TABLE person;\nDROP TABLE audit;\n")},
+	"0002_add_index.up.sql": {Data: []byte(`-- migrate:no-transaction
+-- Indexes of large tables are created out of transactions.
+CREATE INDEX person_name ON person (name);
+`)},
+	"0002_add_index.down.sql": {Data: []byte("DROP INDEX person_name;")},
+	"README.md":               {Data: []byte("not a migration")},
+}
+
+func TestLoad(t *testing.T) {
+	ms, err := Load(migrations)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ms) != 2 || ms[0].Version != 1 || ms[1].Name != "add_index" {
+		t.Fatalf("unexpected migrations: %+v", ms)
+	}
+	if noTransaction(ms[0].Up) || !noTransaction(ms[1].Up) {
+		t.Fatal("only the second migration must be out of transaction")
+	}
+	if _, err := Load(fstest.MapFS{"0001_x.down.sql": {}}); err == nil {
+		t.Fatal("migration without up file must be error")
+	}
+}
+
+func TestMigrator(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	var log bytes.Buffer
+	m := New(db, migrations)
+	m.DryRun = true
+	m.Log = &log
+	if n, err := m.Up(ctx); err != nil || n != 2 {
+		t.Fatalf("dry-run must report 2 migrations: %d, %v", n, err)
+	}
+	if !strings.Contains(log.String(), "CREATE INDEX person_name ON person (name);\n") {
+		t.Fatalf("dry-run must write statements:\n%s", log.String())
+	}
+	var tables int
+	if err := db.Get(&tables, "SELECT count(*) FROM sqlite_master WHERE type = 'table'"); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatalf("dry-run must not change the schema, but got %d tables", tables)
+	}
+
+	m.DryRun = false
+	if n, err := m.Up(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 migrations, but got %d, %v", n, err)
+	}
+	if n, err := m.Up(ctx); err != nil || n != 0 {
+		t.Fatalf("migrations must be applied once, but got %d, %v", n, err)
+	}
+	versions, err := m.Applied(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(versions, []int64{1, 2}) {
+		t.Fatalf("unexpected versions: %v", versions)
+	}
+	db.MustExec("INSERT INTO person (name) VALUES ('Code')")
+	var message string
+	if err := db.Get(&message, "SELECT message FROM audit"); err != nil {
+		t.Fatal(err)
+	}
+	if message != "inserted; Code" {
+		t.Fatalf("trigger must be created, but got %q", message)
+	}
+
+	if n, err := m.Down(ctx, 2); err != nil || n != 2 {
+		t.Fatalf("expected 2 reverted migrations, but got %d, %v", n, err)
+	}
+	if versions, err := m.Applied(ctx); err != nil || len(versions) != 0 {
+		t.Fatalf("unexpected versions: %v, %v", versions, err)
+	}
+}
+
+func TestMigratorError(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	m := New(db, fstest.MapFS{
+		"1_broken.up.sql": {Data: []byte("CREATE TABLE a (x int);\nINSERT INTO missing VALUES (1);")},
+	})
+	_, err := m.Up(ctx)
+	var merr *Error
+	if !errors.As(err, &merr) || merr.Version != 1 || merr.Statement != 1 {
+		t.Fatalf("expected the error of the second statement, but got %v", err)
+	}
+	// The migration is rolled back.
+	var tables int
+	if err := db.Get(&tables, "SELECT count(*) FROM sqlite_master WHERE name = 'a'"); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 0 {
+		t.Fatal("failed migration must be rolled back")
+	}
+	if versions, err := m.Applied(ctx); err != nil || len(versions) != 0 {
+		t.Fatalf("unexpected versions: %v, %v", versions, err)
+	}
+}
+
+func TestMigratorActiveTxm(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	// A transaction of the app is active on the same DB.
+	tx := db.MustBeginTxm()
+	if n, err := New(db, migrations).Up(ctx); err != nil || n != 2 {
+		t.Fatalf("expected 2 migrations, but got %d, %v", n, err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	// Migrations don't join it, so they are not rolled back with it.
+	var tables int
+	if err := db.Get(&tables, "SELECT count(*) FROM sqlite_master WHERE name = 'person'"); err != nil {
+		t.Fatal(err)
+	}
+	if tables != 1 {
+		t.Fatal("migrations must be committed out of the transaction of the app")
+	}
+}
+
+func TestMigratorMiddleware(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	// Migrations in transactions run through middlewares of db.
+	var inTx []string
+	db.Use(func(next sqlx.Handler) sqlx.Handler {
+		return func(ctx context.Context, s *sqlx.Statement) error {
+			if s.Tx != nil {
+				inTx = append(inTx, strings.Fields(s.Query)[0])
+			}
+			return next(ctx, s)
+		}
+	})
+	if _, err := New(db, migrations).Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"CREATE", "CREATE", "CREATE", "INSERT"}
+	if !reflect.DeepEqual(inTx, want) {
+		t.Fatalf("expected %v in the transaction, but got %v", want, inTx)
+	}
+}
@@ -0,0 +1,265 @@
+// Package split splits SQL scripts into statements, so scripts can be
+// executed by drivers which don't accept many statements at once.
+//
+//	stmts, err := split.Statements(dialect.For(db.DriverName()), script)
+package split
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+// Statements splits script into statements of d.
+//
+// Statements are separated by semicolons which are not in quoted strings,
+// identifiers or comments. On postgres, dollar-quoted strings like bodies
+// of functions are not split. On mysql, DELIMITER lines change the
+// separator like the mysql client does. On sqlite, semicolons in
+// BEGIN ... END of CREATE TRIGGER don't separate statements.
+//
+// Statements are trimmed and don't have the separator. Empty statements
+// and statements which have only comments are dropped.
+func Statements(d dialect.Dialect, script string) ([]string, error) {
+	s := &scanner{
+		src:      script,
+		delim:    ";",
+		postgres: d == dialect.Postgres || d == dialect.CockroachDB,
+		mysql:    d == dialect.MySQL,
+		sqlite:   d == dialect.SQLite3,
+	}
+	if err := s.scan(); err != nil {
+		return nil, err
+	}
+	return s.stmts, nil
+}
+
+type scanner struct {
+	src   string
+	delim string
+	stmts []string
+
+	postgres, mysql, sqlite bool
+
+	// The statement which is scanned.
+	start int
+	code  bool     // it has other than spaces and comments
+	words []string // the first words in upper case
+	depth int      // depth of BEGIN ... END in a trigger
+}
+
+func (s *scanner) scan() error {
+	src := s.src
+	for i := 0; i < len(src); {
+		if s.mysql && s.lineStart(i) {
+			if n, delim, ok := delimiter(src[i:]); ok {
+				s.flush(i)
+				s.delim = delim
+				i += n
+				s.start = i
+				continue
+			}
+		}
+		var (
+			n   int
+			err error
+		)
+		c := src[i]
+		switch {
+		case strings.HasPrefix(src[i:], s.delim):
+			if s.trigger() && s.depth > 0 {
+				n = len(s.delim)
+				break
+			}
+			s.flush(i)
+			i += len(s.delim)
+			s.start = i
+			continue
+		case c == '-' && strings.HasPrefix(src[i:], "--") && s.lineComment(i):
+			n = lineEnd(src[i:])
+		case c == '#' && s.mysql:
+			n = lineEnd(src[i:])
+		case c == '/' && strings.HasPrefix(src[i:], "/*"):
+			n, err = s.blockComment(i)
+		case c == '\'' || c == '"' || (c == '`' && !s.postgres):
+			n, err = s.quoted(i, c, c)
+		case c == '[' && s.sqlite:
+			n, err = s.quoted(i, '[', ']')
+		case c == '$' && s.postgres && !identByte(prev(src, i)):
+			n, err = s.dollarQuoted(i)
+		case identByte(c):
+			n = s.word(i)
+		default:
+			n = 1
+			if !isSpace(c) {
+				s.code = true
+			}
+		}
+		if err != nil {
+			return err
+		}
+		i += n
+	}
+	s.flush(len(src))
+	return nil
+}
+
+// flush adds the statement which ends at end.
+func (s *scanner) flush(end int) {
+	if s.code {
+		s.stmts = append(s.stmts, strings.TrimSpace(s.src[s.start:end]))
+	}
+	s.code = false
+	s.words = s.words[:0]
+	s.depth = 0
+}
+
+func (s *scanner) lineStart(i int) bool {
+	for i > 0 && (s.src[i-1] == ' ' || s.src[i-1] == '\t') {
+		i--
+	}
+	return i == 0 || s.src[i-1] == '\n'
+}
+
+// lineComment reports whether -- at i begins a comment.
+// mysql requires a space after it.
+func (s *scanner) lineComment(i int) bool {
+	if !s.mysql || i+2 >= len(s.src) {
+		return true
+	}
+	return isSpace(s.src[i+2])
+}
+
+func (s *scanner) blockComment(i int) (int, error) {
+	// Block comments are nested on postgres.
+	depth := 0
+	for j := i; j+1 < len(s.src); j++ {
+		switch {
+		case s.src[j] == '/' && s.src[j+1] == '*':
+			depth++
+			j++
+		case s.src[j] == '*' && s.src[j+1] == '/':
+			depth--
+			j++
+			if depth == 0 || !s.postgres {
+				return j + 1 - i, nil
+			}
+		}
+	}
+	return 0, s.errorf(i, "unterminated comment")
+}
+
+func (s *scanner) quoted(i int, open, close byte) (int, error) {
+	s.code = true
+	// Backslash escapes quotes in strings of mysql and E'...' of postgres.
+	backslash := (s.mysql && open != '`') ||
+		(s.postgres && open == '\'' && (prev(s.src, i) == 'E' || prev(s.src, i) == 'e') && !identByte(prev(s.src, i-1)))
+	for j := i + 1; j < len(s.src); j++ {
+		switch c := s.src[j]; {
+		case c == '\\' && backslash:
+			j++
+		case c == close:
+			if close == open && j+1 < len(s.src) && s.src[j+1] == close {
+				j++
+				continue
+			}
+			return j + 1 - i, nil
+		}
+	}
+	return 0, s.errorf(i, "unterminated %c", open)
+}
+
+func (s *scanner) dollarQuoted(i int) (int, error) {
+	s.code = true
+	j := i + 1
+	for j < len(s.src) && s.src[j] != '$' && identByte(s.src[j]) && !(j == i+1 && isDigit(s.src[j])) {
+		j++
+	}
+	if j >= len(s.src) || s.src[j] != '$' {
+		// Placeholders like $1 are not dollar quotes.
+		return j - i, nil
+	}
+	tag := s.src[i : j+1]
+	end := strings.Index(s.src[j+1:], tag)
+	if end < 0 {
+		return 0, s.errorf(i, "unterminated %s", tag)
+	}
+	return j + 1 + end + len(tag) - i, nil
+}
+
+func (s *scanner) word(i int) int {
+	s.code = true
+	j := i
+	for j < len(s.src) && identByte(s.src[j]) {
+		j++
+	}
+	w := strings.ToUpper(s.src[i:j])
+	if len(s.words) < 4 {
+		s.words = append(s.words, w)
+	}
+	if s.trigger() {
+		switch w {
+		case "BEGIN", "CASE":
+			s.depth++
+		case "END":
+			s.depth--
+		}
+	}
+	return j - i
+}
+
+// trigger reports whether the statement is CREATE TRIGGER of sqlite.
+func (s *scanner) trigger() bool {
+	if !s.sqlite || len(s.words) < 2 || s.words[0] != "CREATE" {
+		return false
+	}
+	if s.words[1] == "TEMP" || s.words[1] == "TEMPORARY" {
+		return len(s.words) > 2 && s.words[2] == "TRIGGER"
+	}
+	return s.words[1] == "TRIGGER"
+}
+
+func (s *scanner) errorf(i int, format string, args ...interface{}) error {
+	line := strings.Count(s.src[:i], "\n") + 1
+	return fmt.Errorf("split: line %d: %s", line, fmt.Sprintf(format, args...))
+}
+
+// delimiter parses DELIMITER line of mysql.
+func delimiter(src string) (n int, delim string, ok bool) {
+	const keyword = "DELIMITER"
+	if len(src) <= len(keyword) || !strings.EqualFold(src[:len(keyword)], keyword) || !isSpace(src[len(keyword)]) {
+		return 0, "", false
+	}
+	n = lineEnd(src)
+	fields := strings.Fields(src[len(keyword):n])
+	if len(fields) == 0 {
+		return 0, "", false
+	}
+	return n, fields[0], true
+}
+
+// lineEnd returns the length of the line including the newline.
+func lineEnd(src string) int {
+	if i := strings.IndexByte(src, '\n'); i >= 0 {
+		return i + 1
+	}
+	return len(src)
+}
+
+func prev(src string, i int) byte {
+	if i <= 0 {
+		return 0
+	}
+	return src[i-1]
+}
+
+func identByte(c byte) bool {
+	return c == '_' || c == '$' || isDigit(c) || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || c >= 0x80
+}
+
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f' || c == '\v'
+}
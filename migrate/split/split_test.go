@@ -0,0 +1,98 @@
+package split
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+func TestStatements(t *testing.T) {
+	cases := []struct {
+		name   string
+		d      dialect.Dialect
+		script string
+		want   []string
+	}{
+		{
+			name:   "simple",
+			d:      dialect.SQLite3,
+			script: "CREATE TABLE a (x int);\nCREATE TABLE b (y int);\n\n",
+			want:   []string{"CREATE TABLE a (x int)", "CREATE TABLE b (y int)"},
+		},
+		{
+			name:   "quotes and comments",
+			d:      dialect.SQLite3,
+			script: "INSERT INTO a VALUES ('x;y', 'it''s');\n-- a; comment\nSELECT \"a;b\" /* ; */ FROM a; -- trailing",
+			want:   []string{"INSERT INTO a VALUES ('x;y', 'it''s')", "-- a; comment\nSELECT \"a;b\" /* ; */ FROM a"},
+		},
+		{
+			name: "dollar quotes",
+			d:    dialect.Postgres,
+			script: `CREATE FUNCTION f() RETURNS trigger AS $body$
+BEGIN
+	NEW.s := 'a;b'; RETURN NEW;
+END;
+$body$ LANGUAGE plpgsql;
+SELECT $1, $$;$$, E'\';';`,
+			want: []string{
+				"CREATE FUNCTION f() RETURNS trigger AS $body$\nBEGIN\n\tNEW.s := 'a;b'; RETURN NEW;\nEND;\n$body$ LANGUAGE plpgsql",
+				`SELECT $1, $$;$$, E'\';'`,
+			},
+		},
+		{
+			name:   "nested comments",
+			d:      dialect.Postgres,
+			script: "/* a /* b; */ c; */ SELECT 1; SELECT 2",
+			want:   []string{"/* a /* b; */ c; */ SELECT 1", "SELECT 2"},
+		},
+		{
+			name:   "delimiter",
+			d:      dialect.MySQL,
+			script: "DROP PROCEDURE IF EXISTS p;\nDELIMITER //\nCREATE PROCEDURE p()\nBEGIN\n  SELECT 'a\\';'; # comment;\n  SELECT 2;\nEND//\nDELIMITER ;\nCALL p();",
+			want: []string{
+				"DROP PROCEDURE IF EXISTS p",
+				"CREATE PROCEDURE p()\nBEGIN\n  SELECT 'a\\';'; # comment;\n  SELECT 2;\nEND",
+				"CALL p()",
+			},
+		},
+		{
+			name:   "trigger",
+			d:      dialect.SQLite3,
+			script: "CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET y = CASE WHEN y > 0 THEN y END;\n  DELETE FROM c;\nEND;\nSELECT 1;",
+			want: []string{
+				"CREATE TRIGGER t AFTER INSERT ON a BEGIN\n  UPDATE b SET y = CASE WHEN y > 0 THEN y END;\n  DELETE FROM c;\nEND",
+				"SELECT 1",
+			},
+		},
+		{
+			name:   "only comments",
+			d:      dialect.SQLite3,
+			script: "-- nothing\n/* here */;;",
+			want:   nil,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, err := Statements(c.d, c.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Fatalf("expected %q, but got %q", c.want, got)
+			}
+		})
+	}
+}
+
+func TestStatementsError(t *testing.T) {
+	for _, script := range []string{
+		"SELECT 'a;",
+		"SELECT 1; /* comment",
+		"SELECT $x$ body",
+	} {
+		if _, err := Statements(dialect.Postgres, script); err == nil {
+			t.Errorf("%q must be error", script)
+		}
+	}
+}
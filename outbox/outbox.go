@@ -0,0 +1,54 @@
+// Package outbox implements the transactional outbox pattern on top of
+// github.com/Code-Hex/sqlx-transactionmanager.
+//
+// Messages are inserted into the outbox table in the same transaction
+// as the business data, so they are published if and only if the
+// transaction commits. Relay polls the table and hands them to Publisher.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+)
+
+// Message is a message stored in the outbox table.
+type Message struct {
+	ID        int64     `db:"id"`
+	Topic     string    `db:"topic"`
+	Payload   []byte    `db:"payload"`
+	Attempts  int       `db:"attempts"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+// Publisher publishes messages to a broker.
+type Publisher interface {
+	// Publish is called with at-least-once semantics,
+	// so consumers should deduplicate messages by ID.
+	Publish(context.Context, Message) error
+}
+
+// PublisherFunc is an adapter to allow the use of
+// ordinary functions as Publisher.
+type PublisherFunc func(context.Context, Message) error
+
+// Publish calls f(ctx, m).
+func (f PublisherFunc) Publish(ctx context.Context, m Message) error {
+	return f(ctx, m)
+}
+
+const enqueueQuery = `INSERT INTO outbox (topic, payload, created_at, next_attempt_at) VALUES (?, ?, ?, ?)`
+
+// Enqueue inserts a message into the outbox table inside txm.
+// The message is published after txm is committed.
+func Enqueue(txm *sqlx.Txm, topic string, payload []byte) error {
+	return EnqueueContext(context.Background(), txm, topic, payload)
+}
+
+// EnqueueContext is like Enqueue but with context.Context.
+func EnqueueContext(ctx context.Context, txm *sqlx.Txm, topic string, payload []byte) error {
+	now := time.Now().UTC()
+	_, err := txm.ExecContext(ctx, txm.Rebind(enqueueQuery), topic, payload, now, now)
+	return err
+}
@@ -0,0 +1,219 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "outbox.db"))
+	t.Cleanup(func() { db.Close() })
+	schema, err := Schema(db.DriverName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.MustExec(schema)
+	return db
+}
+
+func enqueue(t *testing.T, db *sqlx.DB, commit bool, payloads ...string) {
+	tx, err := db.BeginTxm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range payloads {
+		if err := Enqueue(tx, "person.created", []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if commit {
+		err = tx.Commit()
+	} else {
+		err = tx.Rollback()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRelay(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	enqueue(t, db, false, "rollbacked")
+	enqueue(t, db, true, "a", "b")
+
+	var got []string
+	r := NewRelay(db, PublisherFunc(func(ctx context.Context, m Message) error {
+		got = append(got, string(m.Payload))
+		return nil
+	}))
+	n, err := r.RelayOnce(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Fatalf("unexpected messages: %d, %v", n, got)
+	}
+
+	// Delivered messages must not be relayed again.
+	if n, err := r.RelayOnce(ctx); err != nil || n != 0 {
+		t.Fatalf("expected no message: %d, %v", n, err)
+	}
+}
+
+func TestRelayDeadLetter(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	enqueue(t, db, true, "a")
+
+	errBroker := errors.New("broker is down")
+	calls := 0
+	var dead []Message
+	r := NewRelay(db, PublisherFunc(func(ctx context.Context, m Message) error {
+		calls++
+		return errBroker
+	}))
+	r.MaxAttempts = 3
+	r.Backoff = func(int) time.Duration { return 0 }
+	r.OnDeadLetter = func(m Message, err error) {
+		if err != errBroker {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		dead = append(dead, m)
+	}
+
+	for i := 0; i < 5; i++ {
+		if _, err := r.RelayOnce(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if calls != 3 {
+		t.Fatalf("expected 3 attempts, but got %d", calls)
+	}
+	if len(dead) != 1 || dead[0].Attempts != 3 {
+		t.Fatalf("expected dead letter, but got %+v", dead)
+	}
+
+	var lastError string
+	if err := db.Get(&lastError, "SELECT last_error FROM outbox WHERE dead_at IS NOT NULL"); err != nil {
+		t.Fatal(err)
+	}
+	if lastError != errBroker.Error() {
+		t.Fatalf("unexpected last error: %s", lastError)
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := ExponentialBackoff(time.Second, 10*time.Second)
+	for attempts, want := range map[int]time.Duration{
+		1: time.Second,
+		2: 2 * time.Second,
+		3: 4 * time.Second,
+		5: 10 * time.Second,
+	} {
+		if got := b(attempts); got != want {
+			t.Errorf("attempts %d: expected %s, but got %s", attempts, want, got)
+		}
+	}
+}
+
+func TestRelayConcurrent(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	enqueue(t, db, true, "a")
+
+	var (
+		mu        sync.Mutex
+		published int
+	)
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	r := NewRelay(db, PublisherFunc(func(ctx context.Context, m Message) error {
+		mu.Lock()
+		published++
+		mu.Unlock()
+		select {
+		case started <- struct{}{}:
+			<-release
+		default:
+		}
+		return nil
+	}))
+
+	done := make(chan error, 2)
+	go func() {
+		_, err := r.RelayOnce(ctx)
+		done <- err
+	}()
+	<-started
+	// The second poll must not claim the message which the first is publishing.
+	go func() {
+		_, err := r.RelayOnce(ctx)
+		done <- err
+	}()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	for i := 0; i < 2; i++ {
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if published != 1 {
+		t.Fatalf("message must be published once, but got %d", published)
+	}
+}
+
+func TestRelayRunRetry(t *testing.T) {
+	db := openDB(t)
+	enqueue(t, db, true, "retried")
+	// Polls fail until the table comes back.
+	db.MustExec("ALTER TABLE outbox RENAME TO outbox_")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var got string
+	r := NewRelay(db, PublisherFunc(func(ctx context.Context, m Message) error {
+		got = string(m.Payload)
+		cancel()
+		return nil
+	}))
+	r.RetryBackoff = func(int) time.Duration { return time.Millisecond }
+	failures := 0
+	r.OnPollError = func(err error) {
+		if failures++; failures == 2 {
+			db.MustExec("ALTER TABLE outbox_ RENAME TO outbox")
+		}
+	}
+	if err := r.Run(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	if failures != 2 || got != "retried" {
+		t.Fatalf("expected the message after 2 failures, but got %q after %d", got, failures)
+	}
+}
+
+func TestRelayMaxAttempts(t *testing.T) {
+	db := openDB(t)
+	r := NewRelay(db, PublisherFunc(func(context.Context, Message) error { return nil }))
+	r.MaxAttempts = 0
+	if _, err := r.RelayOnce(context.Background()); err != errSettings {
+		t.Fatalf("expected errSettings, but got %v", err)
+	}
+	if err := r.Run(context.Background()); err != errSettings {
+		t.Fatalf("expected errSettings, but got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+)
+
+// Relay polls the outbox table and hands pending messages to Publisher.
+//
+// Each poll claims messages in its own transaction which does not join
+// the active transaction of DB, so many relays can run concurrently.
+// Messages are published in order of ID within a poll, but a failed
+// message is retried later without blocking following messages.
+type Relay struct {
+	db        *sqlx.DB
+	publisher Publisher
+
+	// BatchSize is the max number of messages claimed by a poll.
+	// It must be positive.
+	BatchSize int
+	// PollInterval is the interval of polls while the outbox is drained.
+	PollInterval time.Duration
+	// MaxAttempts is the number of attempts before a message is
+	// dead-lettered. It must be positive.
+	MaxAttempts int
+	// Backoff returns the delay before the next attempt of a message
+	// which has been attempted the number of times.
+	Backoff func(attempts int) time.Duration
+	// OnDeadLetter is called after a message is dead-lettered if not nil.
+	OnDeadLetter func(Message, error)
+	// RetryBackoff returns the delay before polling again after the
+	// number of consecutive errors of database.
+	RetryBackoff func(failures int) time.Duration
+	// OnPollError is called with the error of database which is retried
+	// by Run if not nil.
+	OnPollError func(error)
+}
+
+// NewRelay returns Relay with default settings.
+func NewRelay(db *sqlx.DB, p Publisher) *Relay {
+	return &Relay{
+		db:           db,
+		publisher:    p,
+		BatchSize:    100,
+		PollInterval: time.Second,
+		MaxAttempts:  10,
+		Backoff:      ExponentialBackoff(time.Second, time.Hour),
+		RetryBackoff: ExponentialBackoff(time.Second, time.Minute),
+	}
+}
+
+// ExponentialBackoff returns Backoff which doubles the delay from base
+// for each attempt up to max.
+func ExponentialBackoff(base, max time.Duration) func(int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 1; i < attempts; i++ {
+			d *= 2
+			if d >= max {
+				return max
+			}
+		}
+		return d
+	}
+}
+
+// Run relays messages until ctx is done, and returns ctx.Err() then.
+// Errors of database are retried after RetryBackoff.
+func (r *Relay) Run(ctx context.Context) error {
+	if err := r.validate(); err != nil {
+		return err
+	}
+	failures := 0
+	for {
+		n, err := r.RelayOnce(ctx)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		wait := r.PollInterval
+		switch {
+		case err != nil:
+			failures++
+			if r.OnPollError != nil {
+				r.OnPollError(err)
+			}
+			if r.RetryBackoff != nil {
+				wait = r.RetryBackoff(failures)
+			}
+		case n >= r.BatchSize:
+			failures = 0
+			continue
+		default:
+			failures = 0
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+var errSettings = errors.New("outbox: BatchSize and MaxAttempts must be positive")
+
+func (r *Relay) validate() error {
+	if r.BatchSize <= 0 || r.MaxAttempts <= 0 {
+		return errSettings
+	}
+	return nil
+}
+
+const (
+	claimQuery = `SELECT id, topic, payload, attempts, created_at FROM outbox
+WHERE delivered_at IS NULL AND dead_at IS NULL AND next_attempt_at <= ?
+ORDER BY id LIMIT ?`
+	deliveredQuery = `UPDATE outbox SET delivered_at = ?, attempts = attempts + 1 WHERE id = ?`
+	retryQuery     = `UPDATE outbox SET attempts = attempts + 1, last_error = ?, next_attempt_at = ? WHERE id = ?`
+	deadQuery      = `UPDATE outbox SET attempts = attempts + 1, last_error = ?, dead_at = ? WHERE id = ?`
+	// lockQuery takes the write lock of sqlite like BEGIN IMMEDIATE.
+	lockQuery = `UPDATE outbox SET id = id WHERE 0 = 1`
+)
+
+// RelayOnce claims pending messages once and publishes them.
+// It returns the number of claimed messages.
+func (r *Relay) RelayOnce(ctx context.Context) (int, error) {
+	if err := r.validate(); err != nil {
+		return 0, err
+	}
+	var (
+		n    int
+		dead []deadLetter
+	)
+	err := tm.RunxWithContext(ctx, nil, r.db.DB, func(tx tm.Executorx) error {
+		// sqlite has no row locks, so relays claim messages one at a time.
+		if r.db.Dialect() == dialect.SQLite3 {
+			if _, err := tx.ExecContext(ctx, lockQuery); err != nil {
+				return err
+			}
+		}
+		var msgs []Message
+		query := tx.Rebind(claimQuery + r.db.Dialect().ForUpdate(true))
+		if err := tx.SelectContext(ctx, &msgs, query, time.Now().UTC(), r.BatchSize); err != nil {
+			return err
+		}
+		for _, m := range msgs {
+			d, err := r.publish(ctx, tx, m)
+			if err != nil {
+				return err
+			}
+			if d != nil {
+				dead = append(dead, *d)
+			}
+		}
+		n = len(msgs)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	if r.OnDeadLetter != nil {
+		for _, d := range dead {
+			r.OnDeadLetter(d.msg, d.err)
+		}
+	}
+	return n, nil
+}
+
+type deadLetter struct {
+	msg Message
+	err error
+}
+
+// publish publishes m and records the result.
+// It returns the message if it is dead-lettered, and the error of database.
+func (r *Relay) publish(ctx context.Context, tx tm.Executorx, m Message) (*deadLetter, error) {
+	perr := r.publisher.Publish(ctx, m)
+	now := time.Now().UTC()
+	m.Attempts++
+	if perr == nil {
+		_, err := tx.ExecContext(ctx, tx.Rebind(deliveredQuery), now, m.ID)
+		return nil, err
+	}
+	if m.Attempts >= r.MaxAttempts {
+		if _, err := tx.ExecContext(ctx, tx.Rebind(deadQuery), perr.Error(), now, m.ID); err != nil {
+			return nil, err
+		}
+		return &deadLetter{msg: m, err: perr}, nil
+	}
+	next := now.Add(r.Backoff(m.Attempts))
+	_, err := tx.ExecContext(ctx, tx.Rebind(retryQuery), perr.Error(), next, m.ID)
+	return nil, err
+}
@@ -0,0 +1,74 @@
+package outbox
+
+import (
+	"fmt"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+// PostgresSchema is DDL of the outbox table for postgres.
+const PostgresSchema = `
+CREATE TABLE IF NOT EXISTS outbox (
+	id bigserial PRIMARY KEY,
+	topic text NOT NULL,
+	payload bytea NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text NULL,
+	created_at timestamp NOT NULL,
+	next_attempt_at timestamp NOT NULL,
+	delivered_at timestamp NULL,
+	dead_at timestamp NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (next_attempt_at, id)
+	WHERE delivered_at IS NULL AND dead_at IS NULL;
+`
+
+// MySQLSchema is DDL of the outbox table for mysql.
+// SKIP LOCKED requires MySQL 8.0 or later.
+const MySQLSchema = `
+CREATE TABLE IF NOT EXISTS outbox (
+	id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	topic varchar(255) NOT NULL,
+	payload longblob NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text NULL,
+	created_at datetime(6) NOT NULL,
+	next_attempt_at datetime(6) NOT NULL,
+	delivered_at datetime(6) NULL,
+	dead_at datetime(6) NULL,
+	INDEX outbox_pending (delivered_at, dead_at, next_attempt_at, id)
+);
+`
+
+// SQLiteSchema is DDL of the outbox table for sqlite3.
+const SQLiteSchema = `
+CREATE TABLE IF NOT EXISTS outbox (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	topic text NOT NULL,
+	payload blob NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	last_error text NULL,
+	created_at timestamp NOT NULL,
+	next_attempt_at timestamp NOT NULL,
+	delivered_at timestamp NULL,
+	dead_at timestamp NULL
+);
+
+CREATE INDEX IF NOT EXISTS outbox_pending ON outbox (delivered_at, dead_at, next_attempt_at, id);
+`
+
+// Schema returns DDL of the outbox table for the driver.
+// The DDL may have many statements, so execute it with
+// multiStatements=true in DSN on mysql.
+func Schema(driverName string) (string, error) {
+	switch dialect.For(driverName) {
+	case dialect.Postgres, dialect.CockroachDB:
+		return PostgresSchema, nil
+	case dialect.MySQL:
+		return MySQLSchema, nil
+	case dialect.SQLite3:
+		return SQLiteSchema, nil
+	}
+	return "", fmt.Errorf("outbox: unsupported driver %q", driverName)
+}
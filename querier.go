@@ -0,0 +1,96 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+
+	sqlxx "github.com/jmoiron/sqlx"
+)
+
+// Querier interface implements for *DB, *Txm, *github.com/jmoiron/sqlx.DB
+// and *github.com/jmoiron/sqlx.Tx. It has every method to read and write
+// which they have in common, so repository code can accept Querier whether
+// it is inside a transaction or not.
+//
+// *github.com/jmoiron/sqlx.Tx does not have NamedQueryContext,
+// so use NamedQueryContext function instead of the method.
+type Querier interface {
+	DriverName() string
+	Rebind(string) string
+	BindNamed(string, interface{}) (string, []interface{}, error)
+
+	Exec(string, ...interface{}) (sql.Result, error)
+	ExecContext(context.Context, string, ...interface{}) (sql.Result, error)
+	MustExec(string, ...interface{}) sql.Result
+	MustExecContext(context.Context, string, ...interface{}) sql.Result
+	NamedExec(string, interface{}) (sql.Result, error)
+	NamedExecContext(context.Context, string, interface{}) (sql.Result, error)
+
+	Query(string, ...interface{}) (*sql.Rows, error)
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+	QueryRow(string, ...interface{}) *sql.Row
+	QueryRowContext(context.Context, string, ...interface{}) *sql.Row
+	Queryx(string, ...interface{}) (*sqlxx.Rows, error)
+	QueryxContext(context.Context, string, ...interface{}) (*sqlxx.Rows, error)
+	QueryRowx(string, ...interface{}) *sqlxx.Row
+	QueryRowxContext(context.Context, string, ...interface{}) *sqlxx.Row
+	NamedQuery(string, interface{}) (*sqlxx.Rows, error)
+
+	Get(interface{}, string, ...interface{}) error
+	GetContext(context.Context, interface{}, string, ...interface{}) error
+	Select(interface{}, string, ...interface{}) error
+	SelectContext(context.Context, interface{}, string, ...interface{}) error
+
+	Prepare(string) (*sql.Stmt, error)
+	PrepareContext(context.Context, string) (*sql.Stmt, error)
+	Preparex(string) (*sqlxx.Stmt, error)
+	PreparexContext(context.Context, string) (*sqlxx.Stmt, error)
+	PrepareNamed(string) (*sqlxx.NamedStmt, error)
+	PrepareNamedContext(context.Context, string) (*sqlxx.NamedStmt, error)
+}
+
+var (
+	_ Querier = (*DB)(nil)
+	_ Querier = (*Txm)(nil)
+	_ Querier = (*sqlxx.DB)(nil)
+	_ Querier = (*sqlxx.Tx)(nil)
+)
+
+// NamedQueryContext using this Querier.
+// Any named placeholder parameters are replaced with fields from arg.
+func NamedQueryContext(ctx context.Context, q Querier, query string, arg interface{}) (*sqlxx.Rows, error) {
+	switch q := q.(type) {
+	case *DB:
+		return q.NamedQueryContext(ctx, query, arg)
+	case *Txm:
+		return q.NamedQueryContext(ctx, query, arg)
+	}
+	return sqlxx.NamedQueryContext(ctx, q, query, arg)
+}
+
+type txmKey struct{}
+
+// WithTxm returns a copy of ctx which carries txm.
+// QuerierFrom returns the txm while it is active.
+func WithTxm(ctx context.Context, txm *Txm) context.Context {
+	return context.WithValue(ctx, txmKey{}, txm)
+}
+
+// TxmFromContext returns *Txm which is carried by ctx.
+func TxmFromContext(ctx context.Context) (*Txm, bool) {
+	txm, ok := ctx.Value(txmKey{}).(*Txm)
+	return txm, ok && txm != nil
+}
+
+// QuerierFrom returns the ambient transaction if it exists, otherwise db.
+// The ambient transaction is *Txm carried by ctx or the active
+// transaction of db which is began by BeginTxm.
+func QuerierFrom(ctx context.Context, db *DB) Querier {
+	if txm, ok := TxmFromContext(ctx); ok && txm.active() {
+		return txm
+	}
+	if db.activeTx.has() {
+		return db.tx
+	}
+	return db
+}
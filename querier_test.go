@@ -0,0 +1,65 @@
+package sqlx
+
+import (
+	"context"
+	"testing"
+)
+
+func TestQuerierFrom(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		ctx := context.Background()
+		if q := QuerierFrom(ctx, db); q != db {
+			t.Fatal("expected DB without transaction")
+		}
+
+		tx, err := db.BeginTxmx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if q := QuerierFrom(ctx, db); q != tx {
+			t.Fatal("expected the active transaction of DB")
+		}
+		if q := QuerierFrom(WithTxm(ctx, tx), db); q != tx {
+			t.Fatal("expected the transaction carried by context")
+		}
+
+		q := QuerierFrom(ctx, db)
+		if _, err := q.NamedExecContext(ctx, "INSERT INTO person (first_name, last_name, email) VALUES (:first_name, :last_name, :email)", &Person{
+			FirstName: "Code",
+			LastName:  "Hex",
+			Email:     "x00.x7f@gmail.com",
+		}); err != nil {
+			t.Fatal(err)
+		}
+		rows, err := NamedQueryContext(ctx, q, "SELECT * FROM person WHERE first_name = :first_name", map[string]interface{}{"first_name": "Code"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		for rows.Next() {
+			n++
+		}
+		rows.Close()
+		if n != 1 {
+			t.Fatalf("expected 1 row in transaction, but got %d", n)
+		}
+		if err := tx.Rollback(); err != nil {
+			t.Fatal(err)
+		}
+
+		if q := QuerierFrom(WithTxm(ctx, tx), db); q != db {
+			t.Fatal("expected DB after the transaction is finished")
+		}
+
+		// The finished transaction in ctx is not used while
+		// another transaction of DB is active.
+		next, err := db.BeginTxmx(ctx, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer next.Rollback()
+		if q := QuerierFrom(WithTxm(ctx, tx), db); q != next {
+			t.Fatal("expected the active transaction instead of the finished one")
+		}
+	})
+}
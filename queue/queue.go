@@ -0,0 +1,95 @@
+// Package queue implements a database-backed job queue on top of
+// github.com/Code-Hex/sqlx-transactionmanager.
+//
+// Jobs are enqueued inside the caller's transaction, so a job exists
+// if and only if the transaction commits. Workers claim jobs with a
+// lease which is renewed by heartbeats, and run each job in its own
+// transaction which also deletes the job, so the side effects of a job
+// and its completion commit atomically.
+package queue
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+)
+
+// DefaultMaxAttempts is the number of attempts used if
+// Params.MaxAttempts is zero.
+const DefaultMaxAttempts = 25
+
+// ErrDuplicateJob is returned by Enqueue when a job which has
+// the same unique key is already enqueued.
+var ErrDuplicateJob = errors.New("queue: job which has the same unique key already exists")
+
+// Job is a job stored in the jobs table.
+type Job struct {
+	ID          int64          `db:"id"`
+	Queue       string         `db:"queue"`
+	Kind        string         `db:"kind"`
+	Payload     []byte         `db:"payload"`
+	Priority    int            `db:"priority"`
+	RunAt       time.Time      `db:"run_at"`
+	Attempts    int            `db:"attempts"`
+	MaxAttempts int            `db:"max_attempts"`
+	UniqueKey   sql.NullString `db:"unique_key"`
+	LastError   sql.NullString `db:"last_error"`
+}
+
+// Params is parameters of a job to enqueue.
+type Params struct {
+	// Queue is the name of the queue which workers poll.
+	Queue string
+	// Kind is the kind of the job for handlers.
+	Kind string
+	// Payload is the argument of the job.
+	Payload []byte
+	// Priority orders jobs. A job which has higher priority runs first.
+	Priority int
+	// RunAt schedules the job. Zero means now.
+	RunAt time.Time
+	// MaxAttempts is the number of attempts before the job is failed.
+	// Zero means DefaultMaxAttempts.
+	MaxAttempts int
+	// UniqueKey prevents enqueuing the same job while it exists
+	// if it is not empty.
+	UniqueKey string
+}
+
+const enqueueQuery = "INSERT INTO jobs (queue, kind, payload, priority, run_at, max_attempts, unique_key) VALUES (?, ?, ?, ?, ?, ?, ?)"
+
+// Enqueue inserts a job inside txm.
+// The job becomes visible to workers after txm is committed.
+// It returns ErrDuplicateJob if the unique key already exists.
+func Enqueue(ctx context.Context, txm *sqlx.Txm, p Params) error {
+	runAt := p.RunAt
+	if runAt.IsZero() {
+		runAt = time.Now()
+	}
+	maxAttempts := p.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	uniqueKey := sql.NullString{String: p.UniqueKey, Valid: p.UniqueKey != ""}
+	payload := p.Payload
+	if payload == nil {
+		payload = []byte{}
+	}
+
+	query := txm.Rebind(enqueueQuery + txm.Dialect().OnConflict([]string{"unique_key"}, nil))
+	res, err := txm.ExecContext(ctx, query, p.Queue, p.Kind, payload, p.Priority, runAt.UTC(), maxAttempts, uniqueKey)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrDuplicateJob
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "queue.db"))
+	t.Cleanup(func() { db.Close() })
+	schema, err := Schema(db.DriverName())
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.MustExec(schema)
+	db.MustExec("CREATE TABLE person (first_name text)")
+	return db
+}
+
+func enqueue(t *testing.T, db *sqlx.DB, params ...Params) {
+	tx, err := db.BeginTxm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	for _, p := range params {
+		if err := Enqueue(context.Background(), tx, p); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func count(t *testing.T, db *sqlx.DB, query string) int {
+	var n int
+	if err := db.Get(&n, query); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestWorkerPriorityAndSchedule(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	enqueue(t, db,
+		Params{Queue: "default", Kind: "low", Priority: 1},
+		Params{Queue: "default", Kind: "high", Priority: 10},
+		Params{Queue: "default", Kind: "later", Priority: 100, RunAt: time.Now().Add(time.Hour)},
+		Params{Queue: "other", Kind: "other", Priority: 100},
+	)
+
+	var kinds []string
+	w := NewWorker(db, "default", HandlerFunc(func(ctx context.Context, tx tm.Executorx, job *Job) error {
+		kinds = append(kinds, job.Kind)
+		_, err := tx.ExecContext(ctx, "INSERT INTO person (first_name) VALUES (?)", job.Kind)
+		return err
+	}))
+	for {
+		worked, err := w.Work(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !worked {
+			break
+		}
+	}
+	if len(kinds) != 2 || kinds[0] != "high" || kinds[1] != "low" {
+		t.Fatalf("unexpected order of jobs: %v", kinds)
+	}
+	if n := count(t, db, "SELECT count(*) FROM person"); n != 2 {
+		t.Fatalf("side effects of jobs must be committed, but got %d rows", n)
+	}
+	if n := count(t, db, "SELECT count(*) FROM jobs"); n != 2 {
+		t.Fatalf("completed jobs must be deleted, but got %d jobs", n)
+	}
+}
+
+func TestWorkerRetry(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	enqueue(t, db, Params{Queue: "default", Kind: "flaky", MaxAttempts: 2})
+
+	errFailed := errors.New("failed")
+	var jobErrs []error
+	w := NewWorker(db, "default", HandlerFunc(func(ctx context.Context, tx tm.Executorx, job *Job) error {
+		// Side effects must be rolled back with the failed attempt.
+		if _, err := tx.ExecContext(ctx, "INSERT INTO person (first_name) VALUES (?)", job.Kind); err != nil {
+			return err
+		}
+		return errFailed
+	}))
+	w.Backoff = func(int) time.Duration { return 0 }
+	w.OnError = func(job *Job, err error) { jobErrs = append(jobErrs, err) }
+
+	for i := 0; i < 3; i++ {
+		if _, err := w.Work(ctx); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(jobErrs) != 2 {
+		t.Fatalf("expected 2 attempts, but got %d", len(jobErrs))
+	}
+	if n := count(t, db, "SELECT count(*) FROM person"); n != 0 {
+		t.Fatalf("side effects of failed jobs must be rolled back, but got %d rows", n)
+	}
+	if n := count(t, db, "SELECT count(*) FROM jobs WHERE failed_at IS NOT NULL AND attempts = 2"); n != 1 {
+		t.Fatal("job must be failed after max attempts")
+	}
+}
+
+func TestEnqueueUniqueKey(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	enqueue(t, db, Params{Queue: "default", Kind: "report", UniqueKey: "report:1"})
+
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	err := Enqueue(ctx, tx, Params{Queue: "default", Kind: "report", UniqueKey: "report:1"})
+	if err != ErrDuplicateJob {
+		t.Fatalf("expected ErrDuplicateJob, but got %v", err)
+	}
+	if err := Enqueue(ctx, tx, Params{Queue: "default", Kind: "report", UniqueKey: "report:2"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWorkerLeaseLost(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+	enqueue(t, db, Params{Queue: "default", Kind: "slow"})
+
+	var jobErr error
+	w := NewWorker(db, "default", HandlerFunc(func(ctx context.Context, tx tm.Executorx, job *Job) error {
+		// Another worker steals the job as if the lease was expired.
+		db.MustExec("UPDATE jobs SET locked_by = 'another'")
+		_, err := tx.ExecContext(ctx, "INSERT INTO person (first_name) VALUES (?)", job.Kind)
+		return err
+	}))
+	w.OnError = func(job *Job, err error) { jobErr = err }
+
+	if _, err := w.Work(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if jobErr != ErrLeaseLost {
+		t.Fatalf("expected ErrLeaseLost, but got %v", jobErr)
+	}
+	if n := count(t, db, "SELECT count(*) FROM person"); n != 0 {
+		t.Fatalf("side effects must be rolled back, but got %d rows", n)
+	}
+}
+
+func TestWorkerRunRetry(t *testing.T) {
+	db := openDB(t)
+	enqueue(t, db, Params{Queue: "default", Kind: "retried"})
+	// Polls fail until the table comes back.
+	db.MustExec("ALTER TABLE jobs RENAME TO jobs_")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var handled string
+	w := NewWorker(db, "default", HandlerFunc(func(ctx context.Context, tx tm.Executorx, job *Job) error {
+		handled = job.Kind
+		cancel()
+		return nil
+	}))
+	w.RetryBackoff = func(int) time.Duration { return time.Millisecond }
+	failures := 0
+	w.OnPollError = func(err error) {
+		if failures++; failures == 2 {
+			db.MustExec("ALTER TABLE jobs_ RENAME TO jobs")
+		}
+	}
+	if err := w.Run(ctx); err != context.Canceled {
+		t.Fatalf("expected context.Canceled, but got %v", err)
+	}
+	if failures != 2 || handled != "retried" {
+		t.Fatalf("expected the job after 2 failures, but got %q after %d", handled, failures)
+	}
+}
+
+func TestWorkerHeartbeat(t *testing.T) {
+	db := openDB(t)
+	w := NewWorker(db, "default", HandlerFunc(func(context.Context, tm.Executorx, *Job) error { return nil }))
+	w.Heartbeat = 0
+	if err := w.Run(context.Background()); err != errInterval {
+		t.Fatalf("expected errInterval, but got %v", err)
+	}
+}
@@ -0,0 +1,86 @@
+package queue
+
+import (
+	"fmt"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+// PostgresSchema is DDL of the jobs table for postgres.
+const PostgresSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id bigserial PRIMARY KEY,
+	queue text NOT NULL,
+	kind text NOT NULL,
+	payload bytea NOT NULL,
+	priority integer NOT NULL DEFAULT 0,
+	run_at timestamp NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	max_attempts integer NOT NULL,
+	unique_key text NULL UNIQUE,
+	last_error text NULL,
+	locked_by text NULL,
+	locked_until timestamp NULL,
+	failed_at timestamp NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_ready ON jobs (queue, priority DESC, run_at, id)
+	WHERE failed_at IS NULL;
+`
+
+// MySQLSchema is DDL of the jobs table for mysql.
+// SKIP LOCKED requires MySQL 8.0 or later.
+const MySQLSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id bigint NOT NULL AUTO_INCREMENT PRIMARY KEY,
+	queue varchar(255) NOT NULL,
+	kind varchar(255) NOT NULL,
+	payload longblob NOT NULL,
+	priority integer NOT NULL DEFAULT 0,
+	run_at datetime(6) NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	max_attempts integer NOT NULL,
+	unique_key varchar(255) NULL UNIQUE,
+	last_error text NULL,
+	locked_by varchar(64) NULL,
+	locked_until datetime(6) NULL,
+	failed_at datetime(6) NULL,
+	INDEX jobs_ready (queue, failed_at, priority, run_at, id)
+);
+`
+
+// SQLiteSchema is DDL of the jobs table for sqlite3.
+const SQLiteSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id integer PRIMARY KEY AUTOINCREMENT,
+	queue text NOT NULL,
+	kind text NOT NULL,
+	payload blob NOT NULL,
+	priority integer NOT NULL DEFAULT 0,
+	run_at timestamp NOT NULL,
+	attempts integer NOT NULL DEFAULT 0,
+	max_attempts integer NOT NULL,
+	unique_key text NULL UNIQUE,
+	last_error text NULL,
+	locked_by text NULL,
+	locked_until timestamp NULL,
+	failed_at timestamp NULL
+);
+
+CREATE INDEX IF NOT EXISTS jobs_ready ON jobs (queue, failed_at, priority, run_at, id);
+`
+
+// Schema returns DDL of the jobs table for the driver.
+// The DDL may have many statements, so execute it with
+// multiStatements=true in DSN on mysql.
+func Schema(driverName string) (string, error) {
+	switch dialect.For(driverName) {
+	case dialect.Postgres, dialect.CockroachDB:
+		return PostgresSchema, nil
+	case dialect.MySQL:
+		return MySQLSchema, nil
+	case dialect.SQLite3:
+		return SQLiteSchema, nil
+	}
+	return "", fmt.Errorf("queue: unsupported driver %q", driverName)
+}
@@ -0,0 +1,323 @@
+package queue
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+)
+
+// ErrLeaseLost is returned when a worker lost the lease of a job because
+// its heartbeat did not renew the lease before the visibility timeout.
+// The transaction of the job is rolled back in this case.
+var ErrLeaseLost = errors.New("queue: lease of the job is lost")
+
+// Handler runs a job.
+type Handler interface {
+	// Handle runs job in tx. The job is completed if Handle returns nil
+	// and tx is committed. Otherwise tx is rolled back and the job is
+	// retried later.
+	Handle(ctx context.Context, tx tm.Executorx, job *Job) error
+}
+
+// HandlerFunc is an adapter to allow the use of
+// ordinary functions as Handler.
+type HandlerFunc func(context.Context, tm.Executorx, *Job) error
+
+// Handle calls f(ctx, tx, job).
+func (f HandlerFunc) Handle(ctx context.Context, tx tm.Executorx, job *Job) error {
+	return f(ctx, tx, job)
+}
+
+// Worker claims jobs from a queue and runs them by Handler.
+//
+// A claimed job is leased to the worker for Visibility and the lease is
+// renewed by heartbeats while the job is running. If the worker dies,
+// another worker claims the job after the lease is expired.
+type Worker struct {
+	db      *sqlx.DB
+	queue   string
+	handler Handler
+
+	// Concurrency is the number of jobs which run at the same time.
+	Concurrency int
+	// PollInterval is the interval of polls while the queue is empty.
+	PollInterval time.Duration
+	// Visibility is the duration of the lease of a claimed job.
+	Visibility time.Duration
+	// Heartbeat is the interval to renew the lease. It must be positive,
+	// and should be shorter than Visibility.
+	Heartbeat time.Duration
+	// Backoff returns the delay before the next attempt of a job
+	// which has been attempted the number of times.
+	Backoff func(attempts int) time.Duration
+	// OnError is called with the error of a job if not nil.
+	OnError func(*Job, error)
+	// RetryBackoff returns the delay before polling again after the
+	// number of consecutive errors of database.
+	RetryBackoff func(failures int) time.Duration
+	// OnPollError is called with the error of database which is retried
+	// by Run if not nil.
+	OnPollError func(error)
+}
+
+// NewWorker returns Worker with default settings.
+func NewWorker(db *sqlx.DB, queue string, h Handler) *Worker {
+	return &Worker{
+		db:           db,
+		queue:        queue,
+		handler:      h,
+		Concurrency:  1,
+		PollInterval: time.Second,
+		Visibility:   time.Minute,
+		Heartbeat:    20 * time.Second,
+		Backoff:      ExponentialBackoff(time.Second, time.Hour),
+		RetryBackoff: ExponentialBackoff(time.Second, time.Minute),
+	}
+}
+
+// ExponentialBackoff returns Backoff which doubles the delay from base
+// for each attempt up to max.
+func ExponentialBackoff(base, max time.Duration) func(int) time.Duration {
+	return func(attempts int) time.Duration {
+		d := base
+		for i := 1; i < attempts; i++ {
+			d *= 2
+			if d >= max {
+				return max
+			}
+		}
+		return d
+	}
+}
+
+// Run runs jobs until ctx is done, and returns ctx.Err() then.
+// Errors of database are retried after RetryBackoff.
+func (w *Worker) Run(ctx context.Context) error {
+	if err := w.validate(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	concurrency := w.Concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	errCh := make(chan error, concurrency)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errCh <- w.loop(ctx)
+		}()
+	}
+	err := <-errCh
+	cancel()
+	wg.Wait()
+	return err
+}
+
+func (w *Worker) loop(ctx context.Context) error {
+	failures := 0
+	for {
+		worked, err := w.Work(ctx)
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+		wait := w.PollInterval
+		switch {
+		case err != nil:
+			failures++
+			if w.OnPollError != nil {
+				w.OnPollError(err)
+			}
+			if w.RetryBackoff != nil {
+				wait = w.RetryBackoff(failures)
+			}
+		case worked:
+			failures = 0
+			continue
+		default:
+			failures = 0
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+	}
+}
+
+var errInterval = errors.New("queue: Heartbeat and Visibility must be positive")
+
+func (w *Worker) validate() error {
+	if w.Heartbeat <= 0 || w.Visibility <= 0 {
+		return errInterval
+	}
+	return nil
+}
+
+// Work claims a job and runs it. It reports whether a job is claimed.
+// The error of the job is not returned, it is recorded to the job
+// and passed to OnError.
+func (w *Worker) Work(ctx context.Context) (bool, error) {
+	if err := w.validate(); err != nil {
+		return false, err
+	}
+	token, err := newToken()
+	if err != nil {
+		return false, err
+	}
+	job, err := w.claim(ctx, token)
+	if err != nil || job == nil {
+		return false, err
+	}
+
+	jobCtx, cancel := context.WithCancel(ctx)
+	lost := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.heartbeat(jobCtx, cancel, lost, job.ID, token)
+	}()
+
+	jobErr := tm.RunxWithContext(jobCtx, nil, w.db.DB, func(tx tm.Executorx) error {
+		if err := w.handler.Handle(jobCtx, tx, job); err != nil {
+			return err
+		}
+		return complete(jobCtx, tx, job.ID, token)
+	})
+	cancel()
+	<-done
+
+	select {
+	case <-lost:
+		jobErr = ErrLeaseLost
+	default:
+	}
+	if jobErr == nil {
+		return true, nil
+	}
+	if w.OnError != nil {
+		w.OnError(job, jobErr)
+	}
+	if jobErr == ErrLeaseLost {
+		// Another worker may own the job already.
+		return true, nil
+	}
+	return true, w.fail(ctx, job, token, jobErr)
+}
+
+const (
+	claimQuery = `SELECT id, queue, kind, payload, priority, run_at, attempts, max_attempts, unique_key, last_error FROM jobs
+WHERE queue = ? AND failed_at IS NULL AND run_at <= ? AND (locked_until IS NULL OR locked_until < ?)
+ORDER BY priority DESC, run_at, id LIMIT 1`
+	leaseQuery     = `UPDATE jobs SET locked_by = ?, locked_until = ?, attempts = attempts + 1 WHERE id = ?`
+	heartbeatQuery = `UPDATE jobs SET locked_until = ? WHERE id = ? AND locked_by = ?`
+	completeQuery  = `DELETE FROM jobs WHERE id = ? AND locked_by = ?`
+	// lockQuery takes the write lock of sqlite like BEGIN IMMEDIATE.
+	lockQuery  = `UPDATE jobs SET id = id WHERE 0 = 1`
+	retryQuery = `UPDATE jobs SET locked_by = NULL, locked_until = NULL, last_error = ?, run_at = ? WHERE id = ? AND locked_by = ?`
+	failQuery  = `UPDATE jobs SET locked_by = NULL, locked_until = NULL, last_error = ?, failed_at = ?, unique_key = NULL WHERE id = ? AND locked_by = ?`
+)
+
+// claim leases a ready job to token. It returns nil if no job is ready.
+func (w *Worker) claim(ctx context.Context, token string) (*Job, error) {
+	var job *Job
+	err := tm.RunxWithContext(ctx, nil, w.db.DB, func(tx tm.Executorx) error {
+		// sqlite has no row locks, so workers claim jobs one at a time.
+		if w.db.Dialect() == dialect.SQLite3 {
+			if _, err := tx.ExecContext(ctx, lockQuery); err != nil {
+				return err
+			}
+		}
+		var jobs []*Job
+		now := time.Now().UTC()
+		query := tx.Rebind(claimQuery + w.db.Dialect().ForUpdate(true))
+		if err := tx.SelectContext(ctx, &jobs, query, w.queue, now, now); err != nil {
+			return err
+		}
+		if len(jobs) == 0 {
+			return nil
+		}
+		job = jobs[0]
+		job.Attempts++
+		_, err := tx.ExecContext(ctx, tx.Rebind(leaseQuery), token, now.Add(w.Visibility), job.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// heartbeat renews the lease until ctx is done.
+// It closes lost and cancels the job if the lease is lost.
+func (w *Worker) heartbeat(ctx context.Context, cancel context.CancelFunc, lost chan<- struct{}, id int64, token string) {
+	ticker := time.NewTicker(w.Heartbeat)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		until := time.Now().UTC().Add(w.Visibility)
+		res, err := w.db.DB.ExecContext(ctx, w.db.Rebind(heartbeatQuery), until, id, token)
+		if err != nil {
+			// The lease is still valid until it is expired,
+			// so try again at the next tick.
+			continue
+		}
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			close(lost)
+			cancel()
+			return
+		}
+	}
+}
+
+// complete deletes the job in the transaction of the job.
+func complete(ctx context.Context, tx tm.Executorx, id int64, token string) error {
+	res, err := tx.ExecContext(ctx, tx.Rebind(completeQuery), id, token)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrLeaseLost
+	}
+	return nil
+}
+
+// fail records the error of the job and schedules the next attempt,
+// or marks the job as failed if it has been attempted max times.
+func (w *Worker) fail(ctx context.Context, job *Job, token string, jobErr error) error {
+	now := time.Now().UTC()
+	if job.Attempts >= job.MaxAttempts {
+		_, err := w.db.DB.ExecContext(ctx, w.db.Rebind(failQuery), jobErr.Error(), now, job.ID, token)
+		return err
+	}
+	runAt := now.Add(w.Backoff(job.Attempts))
+	_, err := w.db.DB.ExecContext(ctx, w.db.Rebind(retryQuery), jobErr.Error(), runAt, job.ID, token)
+	return err
+}
+
+func newToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,47 @@
+package sqlx
+
+import "strings"
+
+// trackSavepoint follows savepoints which are created, released and
+// rolled back to by statements executed in the transaction, so the
+// journal records the savepoint level of statements.
+func (t *Txm) trackSavepoint(query string) {
+	f := strings.Fields(strings.TrimRight(strings.TrimSpace(query), ";"))
+	if len(f) < 2 {
+		return
+	}
+	name := f[len(f)-1]
+	switch verb := strings.ToUpper(f[0]); {
+	case verb == "SAVEPOINT" && len(f) == 2:
+		t.mu.Lock()
+		t.savepoints = append(t.savepoints, name)
+		t.mu.Unlock()
+	case verb == "RELEASE" && (len(f) == 2 || len(f) == 3 && strings.EqualFold(f[1], "SAVEPOINT")):
+		t.popSavepoints(name, false)
+	case verb == "ROLLBACK" && len(f) >= 3 && strings.EqualFold(f[1], "TO") &&
+		(len(f) == 3 || len(f) == 4 && strings.EqualFold(f[2], "SAVEPOINT")):
+		// The savepoint remains, and savepoints created after it are released.
+		t.popSavepoints(name, true)
+	}
+}
+
+func (t *Txm) popSavepoints(name string, keep bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := len(t.savepoints) - 1; i >= 0; i-- {
+		if strings.EqualFold(t.savepoints[i], name) {
+			if keep {
+				i++
+			}
+			t.savepoints = t.savepoints[:i]
+			return
+		}
+	}
+}
+
+// savepointLevel returns the number of active savepoints.
+func (t *Txm) savepointLevel() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return len(t.savepoints)
+}
@@ -0,0 +1,232 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+)
+
+type sessionKey struct{}
+
+// sessionOptions are session variables which are set when
+// a transaction begins with the context.
+type sessionOptions struct {
+	statementTimeout time.Duration
+	lockTimeout      time.Duration
+	vars             map[string]string
+}
+
+func sessionFromContext(ctx context.Context) sessionOptions {
+	o, _ := ctx.Value(sessionKey{}).(sessionOptions)
+	return o
+}
+
+// WithStatementTimeout returns a context which limits the time of each
+// statement of transactions begun with it by BeginTxmx.
+//
+// It sets statement_timeout on postgres and max_execution_time on mysql,
+// which limits only SELECT. It is ignored on sqlite, use the deadline of
+// ctx instead.
+func WithStatementTimeout(ctx context.Context, d time.Duration) context.Context {
+	o := sessionFromContext(ctx)
+	o.statementTimeout = d
+	return context.WithValue(ctx, sessionKey{}, o)
+}
+
+// WithLockTimeout returns a context which limits the time to wait for
+// locks in transactions begun with it by BeginTxmx.
+//
+// It sets lock_timeout on postgres, innodb_lock_wait_timeout on mysql,
+// which is rounded up to seconds, and busy_timeout on sqlite.
+func WithLockTimeout(ctx context.Context, d time.Duration) context.Context {
+	o := sessionFromContext(ctx)
+	o.lockTimeout = d
+	return context.WithValue(ctx, sessionKey{}, o)
+}
+
+// WithSessionVars returns a context which sets vars by SetLocal when
+// a transaction begins with it by BeginTxmx. vars are merged with vars
+// of the parent context.
+func WithSessionVars(ctx context.Context, vars map[string]string) context.Context {
+	o := sessionFromContext(ctx)
+	merged := make(map[string]string, len(o.vars)+len(vars))
+	for name, value := range o.vars {
+		merged[name] = value
+	}
+	for name, value := range vars {
+		merged[name] = value
+	}
+	o.vars = merged
+	return context.WithValue(ctx, sessionKey{}, o)
+}
+
+// setSession sets session variables given by ctx.
+// They are set only when the transaction begins physically,
+// and nested transactions inherit them.
+func (t *Txm) setSession(ctx context.Context) error {
+	o := sessionFromContext(ctx)
+	d := t.Dialect()
+	if o.statementTimeout > 0 {
+		switch d {
+		case dialect.Postgres, dialect.CockroachDB:
+			if err := t.SetLocal(ctx, "statement_timeout", ceil(o.statementTimeout, time.Millisecond)); err != nil {
+				return err
+			}
+		case dialect.MySQL:
+			if err := t.SetLocal(ctx, "max_execution_time", ceil(o.statementTimeout, time.Millisecond)); err != nil {
+				return err
+			}
+		}
+	}
+	if o.lockTimeout > 0 {
+		var err error
+		switch d {
+		case dialect.Postgres, dialect.CockroachDB:
+			err = t.SetLocal(ctx, "lock_timeout", ceil(o.lockTimeout, time.Millisecond))
+		case dialect.MySQL:
+			err = t.SetLocal(ctx, "innodb_lock_wait_timeout", ceil(o.lockTimeout, time.Second))
+		case dialect.SQLite3:
+			err = t.SetLocal(ctx, "busy_timeout", ceil(o.lockTimeout, time.Millisecond))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	names := make([]string, 0, len(o.vars))
+	for name := range o.vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if err := t.SetLocal(ctx, name, o.vars[name]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ceil returns d in unit, rounded up so short durations don't become 0,
+// which disables timeouts.
+func ceil(d, unit time.Duration) string {
+	return strconv.FormatInt(int64((d+unit-1)/unit), 10)
+}
+
+var (
+	sessionName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+	pragmaValue = regexp.MustCompile(`^(-?[0-9]+|[A-Za-z_]+)$`)
+)
+
+// SetLocal sets the session variable name to value until the transaction
+// ends. Nested transactions see it, since they share the transaction.
+//
+// It runs SET LOCAL by set_config on postgres. On mysql it sets the session
+// variable and restores the previous value just before commit or rollback,
+// and on sqlite it does the same by PRAGMA, so value must be an integer or
+// a keyword there.
+func (t *Txm) SetLocal(ctx context.Context, name, value string) error {
+	if !sessionName.MatchString(name) {
+		return fmt.Errorf("sqlx: invalid session variable name %q", name)
+	}
+	switch t.Dialect() {
+	case dialect.Postgres, dialect.CockroachDB:
+		_, err := t.ExecContext(ctx, "SELECT set_config($1, $2, true)", name, value)
+		return err
+	case dialect.MySQL:
+		set := "SET SESSION " + name + " = ?"
+		err := t.saveSession(ctx, name, "SELECT @@SESSION."+name, func(old sql.NullString) {
+			var err error
+			if old.Valid {
+				_, err = t.Tx.Exec(set, mysqlValue(old.String))
+			} else {
+				_, err = t.Tx.Exec("SET SESSION " + name + " = DEFAULT")
+			}
+			if err != nil {
+				t.discardConn()
+			}
+		})
+		if err != nil {
+			return err
+		}
+		_, err = t.ExecContext(ctx, set, mysqlValue(value))
+		return err
+	case dialect.SQLite3:
+		if !pragmaValue.MatchString(value) {
+			return fmt.Errorf("sqlx: invalid value of PRAGMA %s: %q", name, value)
+		}
+		err := t.saveSession(ctx, name, "PRAGMA "+name, func(old sql.NullString) {
+			if old.Valid && pragmaValue.MatchString(old.String) {
+				if _, err := t.Tx.Exec("PRAGMA " + name + " = " + old.String); err != nil {
+					t.discardConn()
+				}
+			}
+		})
+		if err != nil {
+			return err
+		}
+		_, err = t.ExecContext(ctx, "PRAGMA "+name+" = "+value)
+		return err
+	}
+	return fmt.Errorf("sqlx: session variables are not supported on %s", t.DriverName())
+}
+
+// saveSession reads the variable by query when it is set first in the
+// transaction, and registers restore which is called with the value just
+// before the transaction ends. Variables of the connection outlive the
+// transaction, so other transactions on the connection must not see them.
+func (t *Txm) saveSession(ctx context.Context, name, query string, restore func(sql.NullString)) error {
+	t.mu.Lock()
+	_, saved := t.locals[name]
+	t.mu.Unlock()
+	if saved {
+		return nil
+	}
+	var old sql.NullString
+	if err := t.QueryRowxContext(ctx, query).Scan(&old); err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	t.mu.Lock()
+	if t.locals == nil {
+		t.locals = make(map[string]struct{})
+	}
+	t.locals[name] = struct{}{}
+	// Commit holds the lock of statements while hooks run, so restore
+	// uses Tx directly like RELEASE_LOCK of AdvisoryLock.
+	t.beforeEnd = append(t.beforeEnd, func() { restore(old) })
+	t.mu.Unlock()
+	return nil
+}
+
+// discardConn discards the connection of the transaction when it ends,
+// because the session state of it is not restored.
+func (t *Txm) discardConn() {
+	atomic.StoreUint32(&t.discard, 1)
+}
+
+// closeConn returns the connection of the transaction to the pool,
+// or discards it.
+func (t *Txm) closeConn() {
+	if t.conn == nil {
+		return
+	}
+	if atomic.LoadUint32(&t.discard) == 1 {
+		t.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	t.conn.Close()
+}
+
+// mysqlValue returns integers as int64, since mysql rejects strings
+// for integer variables.
+func mysqlValue(s string) interface{} {
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return n
+	}
+	return s
+}
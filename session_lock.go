@@ -0,0 +1,148 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"sync"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+	sqlxx "github.com/jmoiron/sqlx"
+)
+
+// ErrLockLost is returned by SessionLock.Ping when the lock is not held
+// by the connection anymore.
+var ErrLockLost = errors.New("sqlx: session lock is lost")
+
+// SessionLock is an advisory lock which is held by a dedicated connection
+// until it is released or the connection is lost. Unlike AdvisoryLock of
+// Txm, it is not scoped to a transaction.
+type SessionLock struct {
+	conn    *sqlxx.Conn
+	id      int64
+	dialect dialect.Dialect
+
+	mu       sync.Mutex
+	released bool
+}
+
+// SessionLock takes an advisory lock on a dedicated connection.
+// It waits until the lock is available or ctx is done.
+//
+// It uses pg_advisory_lock on postgres and GET_LOCK on mysql.
+// Other dialects use the same in-process lock table as AdvisoryLock.
+func (db *DB) SessionLock(ctx context.Context, key string) (*SessionLock, error) {
+	return db.sessionLock(ctx, key, true)
+}
+
+// TrySessionLock is like SessionLock but does not wait.
+// It returns nil if the lock is held by another session.
+func (db *DB) TrySessionLock(ctx context.Context, key string) (*SessionLock, error) {
+	return db.sessionLock(ctx, key, false)
+}
+
+func (db *DB) sessionLock(ctx context.Context, key string, wait bool) (*SessionLock, error) {
+	conn, err := db.DB.Connx(ctx)
+	if err != nil {
+		return nil, err
+	}
+	l := &SessionLock{
+		conn:    conn,
+		id:      LockKey(key),
+		dialect: db.Dialect(),
+	}
+	ok, err := l.lock(ctx, wait)
+	if err != nil || !ok {
+		conn.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+func (l *SessionLock) lock(ctx context.Context, wait bool) (bool, error) {
+	switch l.dialect {
+	case dialect.Postgres:
+		if wait {
+			_, err := l.conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", l.id)
+			return err == nil, err
+		}
+		var ok bool
+		err := l.conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.id).Scan(&ok)
+		return ok, err
+	case dialect.MySQL:
+		timeout := 0
+		if wait {
+			timeout = -1
+		}
+		var got sql.NullInt64
+		if err := l.conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", lockName(l.id), timeout).Scan(&got); err != nil {
+			return false, err
+		}
+		if !got.Valid {
+			return false, errors.New("sqlx: failed to get lock " + lockName(l.id))
+		}
+		return got.Int64 == 1, nil
+	default:
+		if wait {
+			err := localLocks.lock(ctx, l.id)
+			return err == nil, err
+		}
+		return localLocks.tryLock(l.id), nil
+	}
+}
+
+// Ping verifies that the connection is alive and it still holds the lock.
+// It returns ErrLockLost if the lock is released or not held anymore,
+// otherwise the error of the connection.
+func (l *SessionLock) Ping(ctx context.Context) error {
+	l.mu.Lock()
+	released := l.released
+	l.mu.Unlock()
+	if released {
+		return ErrLockLost
+	}
+	if l.dialect == dialect.MySQL {
+		var held sql.NullBool
+		if err := l.conn.QueryRowContext(ctx, "SELECT IS_USED_LOCK(?) = CONNECTION_ID()", lockName(l.id)).Scan(&held); err != nil {
+			return err
+		}
+		if !held.Valid || !held.Bool {
+			return ErrLockLost
+		}
+		return nil
+	}
+	// Session level locks of postgres are held while the session is alive.
+	var one int
+	return l.conn.QueryRowContext(ctx, "SELECT 1").Scan(&one)
+}
+
+// Release releases the lock and returns the connection into the pool.
+// The connection is closed if the lock cannot be released on it,
+// so the server releases the lock with the session.
+func (l *SessionLock) Release() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.released {
+		return nil
+	}
+	l.released = true
+
+	var err error
+	switch l.dialect {
+	case dialect.Postgres:
+		_, err = l.conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", l.id)
+	case dialect.MySQL:
+		_, err = l.conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", lockName(l.id))
+	default:
+		localLocks.unlock(l.id)
+	}
+	if err != nil {
+		// Discard the connection which may still hold the lock.
+		l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+	}
+	if cerr := l.conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,37 @@
+package sqlx
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSessionLock(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		ctx := context.Background()
+		lock, err := db.SessionLock(ctx, "cron")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := lock.Ping(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if other, err := db.TrySessionLock(ctx, "cron"); err != nil || other != nil {
+			t.Fatalf("lock must be held by another session: %v", err)
+		}
+
+		if err := lock.Release(); err != nil {
+			t.Fatal(err)
+		}
+		if err := lock.Ping(ctx); err != ErrLockLost {
+			t.Fatalf("expected ErrLockLost, but got %v", err)
+		}
+
+		other, err := db.TrySessionLock(ctx, "cron")
+		if err != nil || other == nil {
+			t.Fatalf("failed to take the released lock: %v", err)
+		}
+		if err := other.Release(); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
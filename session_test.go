@@ -0,0 +1,135 @@
+package sqlx
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestSessionVars(t *testing.T) {
+	db := openInterceptedDB(t)
+	// Use a single connection to see variables after the transaction.
+	db.SetMaxOpenConns(1)
+	var busy, cache int
+	if err := db.Get(&busy, "PRAGMA busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&cache, "PRAGMA cache_size"); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithLockTimeout(context.Background(), 1500*time.Millisecond)
+	ctx = WithStatementTimeout(ctx, time.Second)
+	ctx = WithSessionVars(ctx, map[string]string{"cache_size": "-4000"})
+	tx, err := db.BeginTxmx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	nested := db.MustBeginTxm()
+	var got int
+	if err := nested.Get(&got, "PRAGMA busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if got != 1500 {
+		t.Fatalf("expected busy_timeout 1500 in nested transaction, but got %d", got)
+	}
+	if err := nested.SetLocal(ctx, "cache_size", "-8000"); err != nil {
+		t.Fatal(err)
+	}
+	if err := nested.Get(&got, "PRAGMA cache_size"); err != nil {
+		t.Fatal(err)
+	}
+	if got != -8000 {
+		t.Fatalf("expected cache_size -8000, but got %d", got)
+	}
+	if err := nested.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Settings of the context are ignored when joining.
+	joined, err := db.BeginTxmx(WithLockTimeout(context.Background(), time.Second), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := joined.Get(&got, "PRAGMA busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if got != 1500 {
+		t.Fatalf("expected busy_timeout 1500 of the outer transaction, but got %d", got)
+	}
+	if err := joined.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tx.SetLocal(ctx, "cache_size; DROP TABLE person", "1"); err == nil {
+		t.Fatal("invalid name must be error")
+	}
+	if err := tx.SetLocal(ctx, "cache_size", "1; DROP TABLE person"); err == nil {
+		t.Fatal("invalid value must be error")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Variables are restored when the transaction ends.
+	if err := db.Get(&got, "PRAGMA busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if got != busy {
+		t.Fatalf("expected busy_timeout %d after commit, but got %d", busy, got)
+	}
+	if err := db.Get(&got, "PRAGMA cache_size"); err != nil {
+		t.Fatal(err)
+	}
+	if got != cache {
+		t.Fatalf("expected cache_size %d after commit, but got %d", cache, got)
+	}
+}
+
+func TestSessionVarsRollback(t *testing.T) {
+	db := openInterceptedDB(t)
+	db.SetMaxOpenConns(1)
+	var busy int
+	if err := db.Get(&busy, "PRAGMA busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := db.BeginTxmx(WithLockTimeout(context.Background(), time.Microsecond), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got int
+	if err := tx.Get(&got, "PRAGMA busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	// Short timeouts are rounded up, since 0 disables them.
+	if got != 1 {
+		t.Fatalf("expected busy_timeout 1, but got %d", got)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&got, "PRAGMA busy_timeout"); err != nil {
+		t.Fatal(err)
+	}
+	if got != busy {
+		t.Fatalf("expected busy_timeout %d after rollback, but got %d", busy, got)
+	}
+}
+
+func TestSessionDiscardConn(t *testing.T) {
+	db := openInterceptedDB(t)
+	tx := db.MustBeginTxm()
+	if err := tx.SetLocal(context.Background(), "cache_size", "-4000"); err != nil {
+		t.Fatal(err)
+	}
+	// The connection is discarded if restoring variables fails.
+	tx.discardConn()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := db.Stats().OpenConnections; n != 0 {
+		t.Fatalf("the connection must be discarded, but %d are open", n)
+	}
+}
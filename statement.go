@@ -0,0 +1,313 @@
+package sqlx
+
+import (
+	"context"
+	"database/sql"
+
+	sqlxx "github.com/jmoiron/sqlx"
+)
+
+// Statements executed by methods of DB and Txm go through middlewares
+// which are added by DB.Use. In a transaction, they flush deferred
+// statements first, and use cached prepared statements if the statement
+// cache is enabled.
+
+// Exec executes a query that doesn't return rows.
+func (t *Txm) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return t.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a query that doesn't return rows.
+func (t *Txm) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	s := &Statement{Op: OpExec, Query: query, Args: args, Tx: t}
+	err := t.run(ctx, s)
+	return s.Result, err
+}
+
+// MustExec is like Exec but panics on error.
+func (t *Txm) MustExec(query string, args ...interface{}) sql.Result {
+	return t.MustExecContext(context.Background(), query, args...)
+}
+
+// MustExecContext is like ExecContext but panics on error.
+func (t *Txm) MustExecContext(ctx context.Context, query string, args ...interface{}) sql.Result {
+	return sqlxx.MustExecContext(ctx, t, query, args...)
+}
+
+// NamedExec executes a named query.
+// Any named placeholder parameters are replaced with fields from arg.
+func (t *Txm) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	return t.NamedExecContext(context.Background(), query, arg)
+}
+
+// NamedExecContext executes a named query.
+// Any named placeholder parameters are replaced with fields from arg.
+func (t *Txm) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	s := &Statement{Op: OpNamedExec, Query: query, Args: []interface{}{arg}, Tx: t}
+	err := t.run(ctx, s)
+	return s.Result, err
+}
+
+// Query executes a query that returns rows.
+func (t *Txm) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return t.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query that returns rows.
+func (t *Txm) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := t.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows.Rows, nil
+}
+
+// Queryx is like Query but returns *sqlx.Rows.
+func (t *Txm) Queryx(query string, args ...interface{}) (*sqlxx.Rows, error) {
+	return t.QueryxContext(context.Background(), query, args...)
+}
+
+// QueryxContext is like QueryContext but returns *sqlx.Rows.
+func (t *Txm) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlxx.Rows, error) {
+	s := &Statement{Op: OpQuery, Query: query, Args: args, Tx: t}
+	err := t.run(ctx, s)
+	return s.Rows, err
+}
+
+// QueryRow executes a query that returns at most one row.
+// If deferred statements fail, the error is returned by Commit.
+func (t *Txm) QueryRow(query string, args ...interface{}) *sql.Row {
+	return t.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext is like QueryRow with context.
+func (t *Txm) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	s := &Statement{Op: OpQueryRow, Query: query, Args: args, Tx: t, std: true}
+	queryRow(ctx, s, t.run)
+	return s.row
+}
+
+// QueryRowx is like QueryRow but returns *sqlx.Row.
+func (t *Txm) QueryRowx(query string, args ...interface{}) *sqlxx.Row {
+	return t.QueryRowxContext(context.Background(), query, args...)
+}
+
+// QueryRowxContext is like QueryRowContext but returns *sqlx.Row.
+func (t *Txm) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlxx.Row {
+	s := &Statement{Op: OpQueryRow, Query: query, Args: args, Tx: t}
+	queryRow(ctx, s, t.run)
+	return s.rowx
+}
+
+// NamedQuery executes a named query that returns rows.
+// Any named placeholder parameters are replaced with fields from arg.
+func (t *Txm) NamedQuery(query string, arg interface{}) (*sqlxx.Rows, error) {
+	return t.NamedQueryContext(context.Background(), query, arg)
+}
+
+// NamedQueryContext within a transaction.
+// Any named placeholder parameters are replaced with fields from arg.
+func (t *Txm) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlxx.Rows, error) {
+	s := &Statement{Op: OpNamedQuery, Query: query, Args: []interface{}{arg}, Tx: t}
+	err := t.run(ctx, s)
+	return s.Rows, err
+}
+
+// Get gets a row into dest.
+func (t *Txm) Get(dest interface{}, query string, args ...interface{}) error {
+	return t.GetContext(context.Background(), dest, query, args...)
+}
+
+// GetContext gets a row into dest.
+func (t *Txm) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return t.run(ctx, &Statement{Op: OpGet, Query: query, Args: args, Dest: dest, Tx: t})
+}
+
+// Select selects rows into dest.
+func (t *Txm) Select(dest interface{}, query string, args ...interface{}) error {
+	return t.SelectContext(context.Background(), dest, query, args...)
+}
+
+// SelectContext selects rows into dest.
+func (t *Txm) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return t.run(ctx, &Statement{Op: OpSelect, Query: query, Args: args, Dest: dest, Tx: t})
+}
+
+// txmExt executes statements in the transaction without middlewares.
+type txmExt struct{ t *Txm }
+
+func (e txmExt) DriverName() string { return e.t.DriverName() }
+
+func (e txmExt) Rebind(query string) string { return e.t.Rebind(query) }
+
+func (e txmExt) BindNamed(query string, arg interface{}) (string, []interface{}, error) {
+	return e.t.BindNamed(query, arg)
+}
+
+func (e txmExt) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	t := e.t
+	stmt, err := t.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt != nil {
+		return stmt.ExecContext(ctx, args...)
+	}
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+func (e txmExt) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := e.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows.Rows, nil
+}
+
+func (e txmExt) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlxx.Rows, error) {
+	t := e.t
+	stmt, err := t.stmt(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if stmt != nil {
+		return stmt.QueryxContext(ctx, args...)
+	}
+	return t.Tx.QueryxContext(ctx, query, args...)
+}
+
+func (e txmExt) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	t := e.t
+	// If the statement cannot be prepared, the query reports the error.
+	if stmt, err := t.stmt(ctx, query); err == nil && stmt != nil {
+		return stmt.QueryRowContext(ctx, args...)
+	}
+	return t.Tx.QueryRowContext(ctx, query, args...)
+}
+
+func (e txmExt) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlxx.Row {
+	t := e.t
+	if stmt, err := t.stmt(ctx, query); err == nil && stmt != nil {
+		return stmt.QueryRowxContext(ctx, args...)
+	}
+	return t.Tx.QueryRowxContext(ctx, query, args...)
+}
+
+// Exec executes a query that doesn't return rows.
+func (db *DB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return db.ExecContext(context.Background(), query, args...)
+}
+
+// ExecContext executes a query that doesn't return rows.
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	s := &Statement{Op: OpExec, Query: query, Args: args}
+	err := db.run(ctx, s)
+	return s.Result, err
+}
+
+// MustExec is like Exec but panics on error.
+func (db *DB) MustExec(query string, args ...interface{}) sql.Result {
+	return db.MustExecContext(context.Background(), query, args...)
+}
+
+// MustExecContext is like ExecContext but panics on error.
+func (db *DB) MustExecContext(ctx context.Context, query string, args ...interface{}) sql.Result {
+	return sqlxx.MustExecContext(ctx, db, query, args...)
+}
+
+// NamedExec executes a named query.
+// Any named placeholder parameters are replaced with fields from arg.
+func (db *DB) NamedExec(query string, arg interface{}) (sql.Result, error) {
+	return db.NamedExecContext(context.Background(), query, arg)
+}
+
+// NamedExecContext executes a named query.
+// Any named placeholder parameters are replaced with fields from arg.
+func (db *DB) NamedExecContext(ctx context.Context, query string, arg interface{}) (sql.Result, error) {
+	s := &Statement{Op: OpNamedExec, Query: query, Args: []interface{}{arg}}
+	err := db.run(ctx, s)
+	return s.Result, err
+}
+
+// Query executes a query that returns rows.
+func (db *DB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+// QueryContext executes a query that returns rows.
+func (db *DB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	rows, err := db.QueryxContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	return rows.Rows, nil
+}
+
+// Queryx is like Query but returns *sqlx.Rows.
+func (db *DB) Queryx(query string, args ...interface{}) (*sqlxx.Rows, error) {
+	return db.QueryxContext(context.Background(), query, args...)
+}
+
+// QueryxContext is like QueryContext but returns *sqlx.Rows.
+func (db *DB) QueryxContext(ctx context.Context, query string, args ...interface{}) (*sqlxx.Rows, error) {
+	s := &Statement{Op: OpQuery, Query: query, Args: args}
+	err := db.run(ctx, s)
+	return s.Rows, err
+}
+
+// QueryRow executes a query that returns at most one row.
+func (db *DB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return db.QueryRowContext(context.Background(), query, args...)
+}
+
+// QueryRowContext is like QueryRow with context.
+func (db *DB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	s := &Statement{Op: OpQueryRow, Query: query, Args: args, std: true}
+	queryRow(ctx, s, db.run)
+	return s.row
+}
+
+// QueryRowx is like QueryRow but returns *sqlx.Row.
+func (db *DB) QueryRowx(query string, args ...interface{}) *sqlxx.Row {
+	return db.QueryRowxContext(context.Background(), query, args...)
+}
+
+// QueryRowxContext is like QueryRowContext but returns *sqlx.Row.
+func (db *DB) QueryRowxContext(ctx context.Context, query string, args ...interface{}) *sqlxx.Row {
+	s := &Statement{Op: OpQueryRow, Query: query, Args: args}
+	queryRow(ctx, s, db.run)
+	return s.rowx
+}
+
+// NamedQuery executes a named query that returns rows.
+// Any named placeholder parameters are replaced with fields from arg.
+func (db *DB) NamedQuery(query string, arg interface{}) (*sqlxx.Rows, error) {
+	return db.NamedQueryContext(context.Background(), query, arg)
+}
+
+// NamedQueryContext is like NamedQuery with context.
+func (db *DB) NamedQueryContext(ctx context.Context, query string, arg interface{}) (*sqlxx.Rows, error) {
+	s := &Statement{Op: OpNamedQuery, Query: query, Args: []interface{}{arg}}
+	err := db.run(ctx, s)
+	return s.Rows, err
+}
+
+// Get gets a row into dest.
+func (db *DB) Get(dest interface{}, query string, args ...interface{}) error {
+	return db.GetContext(context.Background(), dest, query, args...)
+}
+
+// GetContext gets a row into dest.
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.run(ctx, &Statement{Op: OpGet, Query: query, Args: args, Dest: dest})
+}
+
+// Select selects rows into dest.
+func (db *DB) Select(dest interface{}, query string, args ...interface{}) error {
+	return db.SelectContext(context.Background(), dest, query, args...)
+}
+
+// SelectContext selects rows into dest.
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	return db.run(ctx, &Statement{Op: OpSelect, Query: query, Args: args, Dest: dest})
+}
@@ -0,0 +1,163 @@
+package sqlx
+
+import (
+	"container/list"
+	"context"
+	"sync"
+
+	sqlxx "github.com/jmoiron/sqlx"
+)
+
+// stmtCache is a LRU cache of prepared statements keyed by query.
+type stmtCache struct {
+	size    int
+	prepare func(ctx context.Context, query string) (*sqlxx.Stmt, error)
+	evict   func(*sqlxx.Stmt)
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type stmtEntry struct {
+	query string
+	stmt  *sqlxx.Stmt
+}
+
+func newStmtCache(size int, prepare func(context.Context, string) (*sqlxx.Stmt, error), evict func(*sqlxx.Stmt)) *stmtCache {
+	return &stmtCache{
+		size:    size,
+		prepare: prepare,
+		evict:   evict,
+		ll:      list.New(),
+		items:   map[string]*list.Element{},
+	}
+}
+
+// get returns the statement of query. It is prepared on the first use.
+func (c *stmtCache) get(ctx context.Context, query string) (*sqlxx.Stmt, error) {
+	c.mu.Lock()
+	if e, ok := c.items[query]; ok {
+		c.ll.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*stmtEntry).stmt, nil
+	}
+	c.mu.Unlock()
+
+	// Prepare without the lock, so other queries are not blocked.
+	stmt, err := c.prepare(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[query]; ok {
+		// Another goroutine prepared the same query.
+		c.ll.MoveToFront(e)
+		c.evict(stmt)
+		return e.Value.(*stmtEntry).stmt, nil
+	}
+	c.items[query] = c.ll.PushFront(&stmtEntry{query: query, stmt: stmt})
+	for c.ll.Len() > c.size {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*stmtEntry).query)
+		c.evict(e.Value.(*stmtEntry).stmt)
+	}
+	return stmt, nil
+}
+
+// len returns the number of cached statements.
+func (c *stmtCache) len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.ll.Len()
+}
+
+// close closes all cached statements.
+func (c *stmtCache) close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for e := c.ll.Front(); e != nil; e = e.Next() {
+		e.Value.(*stmtEntry).stmt.Close()
+	}
+	c.ll.Init()
+	c.items = map[string]*list.Element{}
+}
+
+func closeStmt(stmt *sqlxx.Stmt) { stmt.Close() }
+
+// EnableStmtCache enables the cache of prepared statements on db.
+// Up to size statements are prepared on db, and transactions which are
+// begun after this re-bind them by Stmtx instead of preparing queries
+// again. Each transaction caches up to size re-bound statements.
+// size <= 0 disables the cache.
+//
+// It is not safe to call EnableStmtCache concurrently with BeginTxm.
+func (db *DB) EnableStmtCache(size int) {
+	if db.stmts != nil {
+		db.stmts.close()
+		db.stmts = nil
+	}
+	if size > 0 {
+		db.stmts = newStmtCache(size, db.DB.PreparexContext, closeStmt)
+	}
+}
+
+// EnableStmtCache enables the cache of prepared statements in the transaction.
+// Statements executed by methods of Txm are prepared on the first use,
+// and reused until the transaction ends. Up to size statements are cached.
+// size <= 0 disables the cache.
+//
+// If the statement cache of DB is enabled, the cache of the transaction
+// is enabled when it begins, and statements are re-bound from DB.
+func (t *Txm) EnableStmtCache(size int) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.stmts != nil {
+		t.stmts.close()
+		t.stmts = nil
+	}
+	if size <= 0 {
+		return
+	}
+	t.stmts = newStmtCache(size, t.prepareStmt, t.evictStmt)
+	stmts := t.stmts
+	t.afterEnd = append(t.afterEnd, stmts.close)
+}
+
+// prepareStmt prepares query in the transaction,
+// or re-binds the statement which is prepared on DB.
+func (t *Txm) prepareStmt(ctx context.Context, query string) (*sqlxx.Stmt, error) {
+	if t.dbStmts != nil {
+		stmt, err := t.dbStmts.get(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		return t.Tx.StmtxContext(ctx, stmt), nil
+	}
+	return t.Tx.PreparexContext(ctx, query)
+}
+
+// evictStmt closes the statement evicted from the cache of the transaction.
+func (t *Txm) evictStmt(stmt *sqlxx.Stmt) {
+	// Statements prepared in the transaction may be used by rows which
+	// are not closed yet, so they are left to be closed when the
+	// transaction ends. Re-bound statements are closed after such rows.
+	if t.dbStmts != nil {
+		stmt.Close()
+	}
+}
+
+// stmt returns the cached statement of query.
+// It returns nil if the statement cache is disabled.
+func (t *Txm) stmt(ctx context.Context, query string) (*sqlxx.Stmt, error) {
+	t.mu.Lock()
+	stmts := t.stmts
+	t.mu.Unlock()
+	if stmts == nil {
+		return nil, nil
+	}
+	return stmts.get(ctx, query)
+}
@@ -0,0 +1,123 @@
+package sqlx
+
+import (
+	"context"
+	"testing"
+
+	sqlxx "github.com/jmoiron/sqlx"
+)
+
+func TestStmtCacheLRU(t *testing.T) {
+	prepared := map[string]*sqlxx.Stmt{}
+	var evicted []*sqlxx.Stmt
+	c := newStmtCache(2,
+		func(_ context.Context, query string) (*sqlxx.Stmt, error) {
+			stmt := &sqlxx.Stmt{}
+			prepared[query] = stmt
+			return stmt, nil
+		},
+		func(stmt *sqlxx.Stmt) { evicted = append(evicted, stmt) },
+	)
+	get := func(query string) *sqlxx.Stmt {
+		stmt, err := c.get(context.Background(), query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return stmt
+	}
+
+	a, b := get("a"), get("b")
+	if get("a") != a {
+		t.Fatal("cached statement must be reused")
+	}
+	// b is the least recently used.
+	get("c")
+	if len(evicted) != 1 || evicted[0] != b {
+		t.Fatal("least recently used statement must be evicted")
+	}
+	if c.len() != 2 {
+		t.Fatalf("expected 2 statements, but got %d", c.len())
+	}
+	if get("b") == b {
+		t.Fatal("evicted statement must be prepared again")
+	}
+}
+
+func TestTxmStmtCache(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+		tx.EnableStmtCache(2)
+
+		insert := tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		for i := 0; i < 3; i++ {
+			tx.MustExec(insert, "Code", "Hex", "x00.x7f@gmail.com")
+		}
+		stmt, err := tx.stmt(context.Background(), insert)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again, _ := tx.stmt(context.Background(), insert); again != stmt {
+			t.Fatal("statement must be cached in the transaction")
+		}
+
+		var people []Person
+		if err := tx.Select(&people, "SELECT * FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if len(people) != 3 {
+			t.Fatalf("expected 3 people, but got %d", len(people))
+		}
+		if tx.stmts.len() != 2 {
+			t.Fatalf("expected 2 statements, but got %d", tx.stmts.len())
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		if tx.stmts.len() != 0 {
+			t.Fatal("statements must be closed when the transaction ends")
+		}
+	})
+}
+
+func TestDBStmtCache(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		db.EnableStmtCache(4)
+		defer db.EnableStmtCache(0)
+
+		insert := db.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		var stmts []*sqlxx.Stmt
+		for i := 0; i < 2; i++ {
+			tx, err := db.BeginTxm()
+			if err != nil {
+				t.Fatal(err)
+			}
+			tx.MustExec(insert, "Code", "Hex", "x00.x7f@gmail.com")
+			if tx.stmts == nil {
+				t.Fatal("statement cache of the transaction must be enabled")
+			}
+			if err := tx.Commit(); err != nil {
+				t.Fatal(err)
+			}
+			stmt, err := db.stmts.get(context.Background(), insert)
+			if err != nil {
+				t.Fatal(err)
+			}
+			stmts = append(stmts, stmt)
+		}
+		if stmts[0] != stmts[1] || db.stmts.len() != 1 {
+			t.Fatal("statement must be prepared on DB once")
+		}
+
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 2 {
+			t.Fatalf("expected 2 rows, but got %d", n)
+		}
+	})
+}
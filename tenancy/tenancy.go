@@ -0,0 +1,229 @@
+// Package tenancy begins transactions of github.com/Code-Hex/sqlx-transactionmanager
+// on behalf of tenants, so statements of a tenant never see rows of others.
+//
+// The tenant is carried by the context, and transactions are not begun
+// without it:
+//
+//	db := tenancy.RLS(sqlxDB, "app.tenant_id")
+//	ctx = tenancy.WithTenant(ctx, "acme")
+//	err := tm.RunManaged(ctx, nil, db, func(tx tm.Executorx) error {
+//		...
+//	})
+//
+// On postgres the tenant is set by SET LOCAL, and row-level security
+// policies refer to it by current_setting('app.tenant_id'). On mysql and
+// sqlite each tenant has its own database or schema, which is opened by
+// the function given to Route.
+package tenancy
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+)
+
+var (
+	// ErrNoTenant is returned when a transaction begins without a tenant.
+	ErrNoTenant = errors.New("tenancy: no tenant in context")
+	// ErrTenantMismatch is returned when a transaction of a tenant joins
+	// the active transaction of another tenant.
+	ErrTenantMismatch = errors.New("tenancy: tenant differs from the active transaction")
+)
+
+type tenantKey struct{}
+
+// WithTenant returns a context which carries tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, tenant)
+}
+
+// FromContext returns the tenant given by WithTenant.
+func FromContext(ctx context.Context) (string, bool) {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant, tenant != ""
+}
+
+// tenants holds the tenant of each active transaction.
+var tenants sync.Map
+
+// TenantOf returns the tenant of txm which is begun by DB.
+func TenantOf(txm *sqlx.Txm) (string, bool) {
+	tenant, ok := tenants.Load(txm)
+	if !ok {
+		return "", false
+	}
+	return tenant.(string), true
+}
+
+var _ tm.Manager = (*DB)(nil)
+
+// DB begins transactions of the tenant in the context.
+// Transactions of the underlying databases must be begun by DB,
+// otherwise they are not known as transactions of tenants.
+type DB struct {
+	shared  *sqlx.DB
+	setting string
+	open    func(tenant string) (*sqlx.DB, error)
+
+	mu     sync.Mutex
+	dbs    map[string]*sqlx.DB
+	begins map[*sqlx.DB]*sync.Mutex
+}
+
+// RLS returns DB which begins transactions on db, and sets setting, like
+// "app.tenant_id", to the tenant by SET LOCAL. It is for postgres.
+//
+// *sqlx.DB has a single active transaction which nested transactions
+// join, so transactions of tenants on db don't run in parallel. While a
+// transaction of a tenant is active, BeginTxmx for another tenant returns
+// ErrTenantMismatch instead of waiting for it. Use a *sqlx.DB for each
+// request, or Route, to run transactions of tenants concurrently.
+func RLS(db *sqlx.DB, setting string) *DB {
+	return &DB{shared: db, setting: setting, begins: make(map[*sqlx.DB]*sync.Mutex)}
+}
+
+// Route returns DB which begins transactions on the database of each
+// tenant. open is called once for each tenant, like opening the sqlite
+// file of the tenant, or the mysql database named after the tenant.
+func Route(open func(tenant string) (*sqlx.DB, error)) *DB {
+	return &DB{
+		open:   open,
+		dbs:    make(map[string]*sqlx.DB),
+		begins: make(map[*sqlx.DB]*sync.Mutex),
+	}
+}
+
+// For returns the database of the tenant in ctx, for statements
+// outside of transactions. Statements on the database of RLS are not
+// limited to the tenant outside of transactions.
+func (d *DB) For(ctx context.Context) (*sqlx.DB, error) {
+	tenant, ok := FromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.db(tenant)
+}
+
+func (d *DB) db(tenant string) (*sqlx.DB, error) {
+	if d.shared != nil {
+		return d.shared, nil
+	}
+	if db, ok := d.dbs[tenant]; ok {
+		return db, nil
+	}
+	db, err := d.open(tenant)
+	if err != nil {
+		return nil, fmt.Errorf("tenancy: failed to open database of %s: %w", tenant, err)
+	}
+	d.dbs[tenant] = db
+	return db, nil
+}
+
+// BeginTxmx begins a transaction of the tenant in ctx, or joins the active
+// transaction of the tenant like BeginTxmx of *sqlx.DB. It returns
+// ErrNoTenant if ctx has no tenant, and ErrTenantMismatch if the active
+// transaction, or the transaction carried by ctx, is of another tenant.
+func (d *DB) BeginTxmx(ctx context.Context, opts *sql.TxOptions) (*sqlx.Txm, error) {
+	tenant, ok := FromContext(ctx)
+	if !ok {
+		return nil, ErrNoTenant
+	}
+	// The transaction carried by ctx may be on the database of another
+	// tenant, which BeginTxmx does not join.
+	if outer, ok := sqlx.TxmFromContext(ctx); ok {
+		if active, ok := TenantOf(outer); ok && active != tenant {
+			return nil, mismatch(active, tenant)
+		}
+	}
+
+	d.mu.Lock()
+	db, err := d.db(tenant)
+	var begin *sync.Mutex
+	if err == nil {
+		begin = d.begins[db]
+		if begin == nil {
+			begin = new(sync.Mutex)
+			d.begins[db] = begin
+		}
+	}
+	d.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	// Whether to join the active transaction is decided with beginning it,
+	// so a transaction of another tenant is not joined without the check.
+	// Only begins on the same database wait for it.
+	begin.Lock()
+	defer begin.Unlock()
+	// QuerierFrom returns the active transaction which BeginTxmx joins.
+	if active, ok := sqlx.QuerierFrom(context.Background(), db).(*sqlx.Txm); ok {
+		if err := check(active, tenant); err != nil {
+			return nil, err
+		}
+	}
+
+	// The active transaction may end before BeginTxmx joins it, so the
+	// new transaction is prepared for the tenant too. Session variables
+	// are not set when it joins.
+	if d.setting != "" {
+		ctx = sqlx.WithSessionVars(ctx, map[string]string{d.setting: tenant})
+	}
+	txm, err := db.BeginTxmx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	if _, loaded := tenants.LoadOrStore(txm, tenant); !loaded {
+		forget := func(*sqlx.Txm) { tenants.Delete(txm) }
+		txm.AfterCommit(forget)
+		txm.AfterRollback(forget)
+	}
+	return txm, nil
+}
+
+// check returns ErrTenantMismatch if txm is not of tenant.
+// Transactions which are not begun by DB have no tenant,
+// so they are not joined either.
+func check(txm *sqlx.Txm, tenant string) error {
+	if active, _ := TenantOf(txm); active != tenant {
+		return mismatch(active, tenant)
+	}
+	return nil
+}
+
+func mismatch(active, tenant string) error {
+	return fmt.Errorf("%w: %q is active, but %q is given", ErrTenantMismatch, active, tenant)
+}
+
+// BeginManaged is like BeginTxmx. It implements tm.Manager,
+// so transaction blocks of the tm package run on behalf of the tenant.
+func (d *DB) BeginManaged(ctx context.Context, opts *sql.TxOptions) (tm.Transaction, error) {
+	txm, err := d.BeginTxmx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return txm, nil
+}
+
+// Close closes databases which are opened for tenants by Route.
+// The database given to RLS is not closed.
+func (d *DB) Close() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	var first error
+	for tenant, db := range d.dbs {
+		if err := db.Close(); err != nil && first == nil {
+			first = err
+		}
+		delete(d.dbs, tenant)
+		delete(d.begins, db)
+	}
+	return first
+}
@@ -0,0 +1,170 @@
+package tenancy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openDB(t *testing.T, name string) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), name+".db"))
+	t.Cleanup(func() { db.Close() })
+	db.MustExec("CREATE TABLE note (body text)")
+	return db
+}
+
+func TestRoute(t *testing.T) {
+	dbs := map[string]*sqlx.DB{
+		"acme":   openDB(t, "acme"),
+		"globex": openDB(t, "globex"),
+	}
+	d := Route(func(tenant string) (*sqlx.DB, error) {
+		db, ok := dbs[tenant]
+		if !ok {
+			return nil, errors.New("unknown tenant")
+		}
+		return db, nil
+	})
+
+	if _, err := d.BeginTxmx(context.Background(), nil); err != ErrNoTenant {
+		t.Fatalf("expected ErrNoTenant, but got %v", err)
+	}
+	if _, err := d.BeginTxmx(WithTenant(context.Background(), "initech"), nil); err == nil {
+		t.Fatal("unknown tenant must be error")
+	}
+
+	acme := WithTenant(context.Background(), "acme")
+	err := tm.RunManaged(acme, nil, d, func(tx tm.Executorx) error {
+		_, err := tx.Exec("INSERT INTO note (body) VALUES ('hello')")
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := d.BeginTxmx(acme, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if tenant, _ := TenantOf(tx); tenant != "acme" {
+		t.Fatalf("unexpected tenant %q", tenant)
+	}
+	nested, err := d.BeginTxmx(acme, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if nested != tx {
+		t.Fatal("nested transaction of the same tenant must join")
+	}
+	if err := nested.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Code in the transaction of acme must not begin a transaction of globex.
+	globex := WithTenant(sqlx.WithTxm(acme, tx), "globex")
+	if _, err := d.BeginTxmx(globex, nil); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected ErrTenantMismatch, but got %v", err)
+	}
+
+	var n int
+	if err := tx.Get(&n, "SELECT count(*) FROM note"); err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 note of acme, but got %d", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	db, err := d.For(WithTenant(context.Background(), "globex"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Get(&n, "SELECT count(*) FROM note"); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected no notes of globex, but got %d", n)
+	}
+}
+
+func TestSharedMismatch(t *testing.T) {
+	// Tenants on a shared database join the active transaction,
+	// like RLS on postgres.
+	shared := openDB(t, "shared")
+	d := Route(func(string) (*sqlx.DB, error) { return shared, nil })
+
+	tx, err := d.BeginTxmx(WithTenant(context.Background(), "acme"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if _, err := d.BeginTxmx(WithTenant(context.Background(), "globex"), nil); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected ErrTenantMismatch, but got %v", err)
+	}
+	// The rejected transaction does not join, so the outer one commits.
+	tx.MustExec("INSERT INTO note (body) VALUES ('hello')")
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Transactions which are not begun by DB are not joined.
+	raw := shared.MustBeginTxm()
+	defer raw.Rollback()
+	if _, err := d.BeginTxmx(WithTenant(context.Background(), "acme"), nil); !errors.Is(err, ErrTenantMismatch) {
+		t.Fatalf("expected ErrTenantMismatch, but got %v", err)
+	}
+}
+
+func TestRouteConcurrent(t *testing.T) {
+	acme, globex := openDB(t, "acme"), openDB(t, "globex")
+	d := Route(func(tenant string) (*sqlx.DB, error) {
+		if tenant == "acme" {
+			return acme, nil
+		}
+		return globex, nil
+	})
+
+	// The transaction of acme waits for admission.
+	a := sqlx.NewAdmission(1)
+	acme.SetAdmission(a)
+	release, err := a.Acquire(context.Background(), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	began := make(chan error, 1)
+	go func() {
+		tx, err := d.BeginTxmx(WithTenant(context.Background(), "acme"), nil)
+		if err == nil {
+			err = tx.Commit()
+		}
+		began <- err
+	}()
+	for a.Stats().Waiting == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// Tenants on other databases don't wait for it.
+	tx, err := d.BeginTxmx(WithTenant(context.Background(), "globex"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	release()
+	if err := <-began; err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,63 @@
+package tm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+)
+
+// RollbackError is an error type to notice that rollback is failed
+// after the transaction block is failed. It is joined with the error
+// of the transaction block, so use errors.As to get it.
+type RollbackError struct {
+	Err error
+}
+
+func (r *RollbackError) Error() string {
+	return "tm: failed to rollback: " + r.Err.Error()
+}
+
+// Unwrap returns the error of rollback.
+func (r *RollbackError) Unwrap() error {
+	return r.Err
+}
+
+// CommitError is an error type to notice that commit is failed.
+type CommitError struct {
+	Err error
+	// Unknown reports whether the outcome of the commit is unknown.
+	// It is true if the connection was lost while committing, so the
+	// transaction may have been committed on the server.
+	// Otherwise the transaction was definitely not committed.
+	Unknown bool
+}
+
+func (c *CommitError) Error() string {
+	if c.Unknown {
+		return "tm: outcome of commit is unknown: " + c.Err.Error()
+	}
+	return "tm: failed to commit: " + c.Err.Error()
+}
+
+// Unwrap returns the error of commit.
+func (c *CommitError) Unwrap() error {
+	return c.Err
+}
+
+func newCommitError(err error) *CommitError {
+	return &CommitError{
+		Err:     err,
+		Unknown: isConnectionLost(err),
+	}
+}
+
+func isConnectionLost(err error) bool {
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.EOF) ||
+		errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var nerr net.Error
+	return errors.As(err, &nerr)
+}
@@ -0,0 +1,84 @@
+package tm
+
+import (
+	"database/sql/driver"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/faulty"
+	"github.com/jmoiron/sqlx"
+)
+
+func openFaultyDB(t *testing.T) (*sqlx.DB, *faulty.Injector) {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	inj := faulty.MustRegister("sqlite3")
+	inj.Reset()
+	db := sqlx.MustOpen(faulty.Name("sqlite3"), filepath.Join(t.TempDir(), "tm.db"))
+	t.Cleanup(func() { db.Close() })
+	db.MustExec("CREATE TABLE person (first_name text, last_name text)")
+	return db, inj
+}
+
+func insertPerson(tx Executorx) error {
+	_, err := tx.Exec(tx.Rebind("INSERT INTO person (first_name, last_name) VALUES (?, ?)"), "Code", "Hex")
+	return err
+}
+
+func TestCommitErrorUnknown(t *testing.T) {
+	db, inj := openFaultyDB(t)
+	inj.Add(faulty.Rule{Op: faulty.OpCommit, Nth: 1, AfterApply: true})
+
+	err := Runx(db, insertPerson)
+	var cerr *CommitError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected *CommitError, but got %v", err)
+	}
+	if !cerr.Unknown {
+		t.Fatal("outcome must be unknown when the connection is lost")
+	}
+	if !errors.Is(err, driver.ErrBadConn) {
+		t.Fatal("CommitError must unwrap the error of commit")
+	}
+}
+
+func TestCommitErrorFailed(t *testing.T) {
+	db, inj := openFaultyDB(t)
+	errSerialization := errors.New("could not serialize access")
+	inj.Add(faulty.Rule{Op: faulty.OpCommit, Nth: 1, Err: errSerialization})
+
+	err := Runx(db, insertPerson)
+	var cerr *CommitError
+	if !errors.As(err, &cerr) {
+		t.Fatalf("expected *CommitError, but got %v", err)
+	}
+	if cerr.Unknown {
+		t.Fatal("outcome must be known when the server rejected commit")
+	}
+}
+
+func TestRollbackError(t *testing.T) {
+	db, inj := openFaultyDB(t)
+	errFailed := errors.New("failed")
+	inj.Add(faulty.Rule{Op: faulty.OpRollback, Nth: 1})
+
+	err := Runx(db, func(tx Executorx) error {
+		if err := insertPerson(tx); err != nil {
+			return err
+		}
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("expected the error of transaction block, but got %v", err)
+	}
+	var rerr *RollbackError
+	if !errors.As(err, &rerr) {
+		t.Fatalf("expected *RollbackError, but got %v", err)
+	}
+	if rerr.Err != driver.ErrBadConn {
+		t.Fatalf("unexpected rollback error: %v", rerr.Err)
+	}
+}
@@ -0,0 +1,58 @@
+package tm
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is returned by transaction blocks wrapped by Recover or
+// Recoverx instead of panicking.
+type PanicError struct {
+	// Value is the value passed to panic.
+	Value interface{}
+	// Stack is the stack trace of the goroutine which panicked.
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("tm: panic in transaction block: %v", p.Value)
+}
+
+// Unwrap returns Value if it is an error.
+func (p *PanicError) Unwrap() error {
+	if err, ok := p.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// Recover wraps TxnFunc to convert a panic into *PanicError.
+// So Run rollbacks and returns *PanicError instead of panicking.
+//
+//	err := tm.Run(db, tm.Recover(func(tx tm.Executor) error { ... }))
+func Recover(f TxnFunc) TxnFunc {
+	return func(tx Executor) (err error) {
+		defer recoverTo(&err)
+		return f(tx)
+	}
+}
+
+// Recoverx wraps TxnxFunc to convert a panic into *PanicError.
+// So Runx rollbacks and returns *PanicError instead of panicking.
+//
+//	err := tm.Runx(db, tm.Recoverx(func(tx tm.Executorx) error { ... }))
+func Recoverx(f TxnxFunc) TxnxFunc {
+	return func(tx Executorx) (err error) {
+		defer recoverTo(&err)
+		return f(tx)
+	}
+}
+
+func recoverTo(err *error) {
+	if r := recover(); r != nil {
+		*err = &PanicError{
+			Value: r,
+			Stack: debug.Stack(),
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package tm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRunxPanic(t *testing.T) {
+	db := openDB(t)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "Something failed" {
+				t.Fatalf("expected original panic value, but got %v", r)
+			}
+		}()
+		Runx(db, func(tx Executorx) error {
+			tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name) VALUES (?, ?)"), "Code", "Hex")
+			panic("Something failed")
+		})
+	}()
+
+	// The connection must be released, otherwise this blocks with a single connection.
+	db.SetMaxOpenConns(1)
+	if n, err := Get[int](context.Background(), db, "SELECT count(*) FROM person"); err != nil || n != 0 {
+		t.Fatalf("transaction must be rolled back: %d, %v", n, err)
+	}
+}
+
+func TestRecoverx(t *testing.T) {
+	db := openDB(t)
+	errFailed := errors.New("failed")
+
+	err := Runx(db, Recoverx(func(tx Executorx) error {
+		tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name) VALUES (?, ?)"), "Code", "Hex")
+		panic(errFailed)
+	}))
+	var perr *PanicError
+	if !errors.As(err, &perr) {
+		t.Fatalf("expected *PanicError, but got %v", err)
+	}
+	if perr.Value != errFailed || len(perr.Stack) == 0 {
+		t.Fatalf("unexpected panic error: %+v", perr)
+	}
+	if !errors.Is(err, errFailed) {
+		t.Fatal("PanicError must unwrap the panic value")
+	}
+	if n, err := Get[int](context.Background(), db, "SELECT count(*) FROM person"); err != nil || n != 0 {
+		t.Fatalf("transaction must be rolled back: %d, %v", n, err)
+	}
+}
+
+func TestRecover(t *testing.T) {
+	db := openDB(t)
+
+	err := Run(db, Recover(func(tx Executor) error {
+		panic("Something failed")
+	}))
+	if perr, ok := err.(*PanicError); !ok || perr.Value != "Something failed" {
+		t.Fatalf("expected *PanicError, but got %v", err)
+	}
+}
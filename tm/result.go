@@ -0,0 +1,68 @@
+package tm
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// RunResult is like RunWithContext but returns the result of f.
+// It returns the zero value of T if the transaction is failed.
+func RunResult[T any](ctx context.Context, opts *sql.TxOptions, db SQL, f func(Executor) (T, error)) (T, error) {
+	var result T
+	err := RunWithContext(ctx, opts, db, func(tx Executor) error {
+		v, err := f(tx)
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// RunxResult is like RunxWithContext but returns the result of f.
+// It returns the zero value of T if the transaction is failed.
+func RunxResult[T any](ctx context.Context, opts *sql.TxOptions, db SQLx, f func(Executorx) (T, error)) (T, error) {
+	var result T
+	err := RunxWithContext(ctx, opts, db, func(tx Executorx) error {
+		v, err := f(tx)
+		if err != nil {
+			return err
+		}
+		result = v
+		return nil
+	})
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	return result, nil
+}
+
+// Get scans a single row into a freshly allocated T.
+// Any placeholder parameters are replaced with supplied args.
+// An error is returned if the result set is empty.
+func Get[T any](ctx context.Context, q sqlx.QueryerContext, query string, args ...interface{}) (T, error) {
+	var dest T
+	if err := sqlx.GetContext(ctx, q, &dest, query, args...); err != nil {
+		var zero T
+		return zero, err
+	}
+	return dest, nil
+}
+
+// Select scans all rows into a freshly allocated slice of T.
+// Any placeholder parameters are replaced with supplied args.
+func Select[T any](ctx context.Context, q sqlx.QueryerContext, query string, args ...interface{}) ([]T, error) {
+	var dest []T
+	if err := sqlx.SelectContext(ctx, q, &dest, query, args...); err != nil {
+		return nil, err
+	}
+	return dest, nil
+}
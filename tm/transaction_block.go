@@ -1,8 +1,19 @@
+// Package tm runs transaction blocks which commit when the block returns
+// nil, and roll back when it returns an error or panics.
+//
+// *sqlx.DB of github.com/Code-Hex/sqlx-transactionmanager implements
+// Manager, and has a single active transaction which nested transactions
+// join. So tm.Run on the DB joins the active transaction, even if it is
+// begun by another goroutine, and concurrent calls of tm.Run share one
+// transaction: one of them rolling back makes the others fail at commit.
+// To run a block in its own transaction, pass the embedded *sqlx.DB of
+// jmoiron/sqlx, like tm.Runx(db.DB, f), or use a DB for each goroutine.
 package tm
 
 import (
 	"context"
 	"database/sql"
+	"errors"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -63,6 +74,24 @@ type Executorx interface {
 	Unsafe() *sqlx.Tx
 }
 
+// Transaction interface implements for *sqlx.Txm of
+// github.com/Code-Hex/sqlx-transactionmanager or wrapped it.
+type Transaction interface {
+	Executorx
+
+	Commit() error
+	Rollback() error
+}
+
+// Manager interface implements for *sqlx.DB and *sqlx.Txm of
+// github.com/Code-Hex/sqlx-transactionmanager.
+// The transaction which is began by Manager joins the active transaction
+// if it exists, so transaction blocks compose with BeginTxm.
+// *sqlx.DB has one active transaction shared by all goroutines.
+type Manager interface {
+	BeginManaged(context.Context, *sql.TxOptions) (Transaction, error)
+}
+
 // TxnFunc implemtnts for func(Executor) error
 type TxnFunc func(Executor) error
 
@@ -71,60 +100,109 @@ type TxnxFunc func(Executorx) error
 
 // Run begins transaction around TxnFunc.
 // It returns error and rollbacks if TxnFunc is failed.
-// It commits if TxnFunc is successed.
+// The error of rollback is joined as *RollbackError if rollback is failed too.
+// It commits if TxnFunc is successed, and returns *CommitError if commit is failed.
+// If TxnFunc panics, it rollbacks and panics again with the same value.
+// If db implements Manager, the transaction joins the active transaction of it.
 func Run(db SQL, f TxnFunc) error {
-	tx, err := db.Begin()
-	if err != nil {
-		return err
+	if m, ok := db.(Manager); ok {
+		return runManaged(context.Background(), nil, m, func(tx Transaction) error { return f(tx) })
 	}
-	if err := f(tx); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
+	return run(db.Begin, func(tx *sql.Tx) error { return f(tx) })
 }
 
 // RunWithContext begins transaction with context.Conntext around TxnFunc.
 // It returns error and rollbacks if TxnFunc is failed.
-// It commits if TxnFunc is successed.
+// The error of rollback is joined as *RollbackError if rollback is failed too.
+// It commits if TxnFunc is successed, and returns *CommitError if commit is failed.
+// If TxnFunc panics, it rollbacks and panics again with the same value.
+// If db implements Manager, the transaction joins the active transaction of it.
 func RunWithContext(ctx context.Context, opts *sql.TxOptions, db SQL, f TxnFunc) error {
-	tx, err := db.BeginTx(ctx, opts)
-	if err != nil {
-		return err
+	if m, ok := db.(Manager); ok {
+		return runManaged(ctx, opts, m, func(tx Transaction) error { return f(tx) })
 	}
-	if err := f(tx); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
+	begin := func() (*sql.Tx, error) { return db.BeginTx(ctx, opts) }
+	return run(begin, func(tx *sql.Tx) error { return f(tx) })
 }
 
 // Runx begins transaction around TxnxFunc.
 // It returns error and rollbacks if TxnxFunc is failed.
-// It commits if TxnxFunc is successed.
+// The error of rollback is joined as *RollbackError if rollback is failed too.
+// It commits if TxnxFunc is successed, and returns *CommitError if commit is failed.
+// If TxnxFunc panics, it rollbacks and panics again with the same value.
+// If db implements Manager, the transaction joins the active transaction of it.
 func Runx(db SQLx, f TxnxFunc) error {
-	tx, err := db.Beginx()
-	if err != nil {
-		return err
+	if m, ok := db.(Manager); ok {
+		return runManaged(context.Background(), nil, m, func(tx Transaction) error { return f(tx) })
 	}
-	if err := f(tx); err != nil {
-		tx.Rollback()
-		return err
-	}
-	return tx.Commit()
+	return run(db.Beginx, func(tx *sqlx.Tx) error { return f(tx) })
 }
 
 // RunxWithContext begins transaction with context.Conntext around TxnxFunc.
 // It returns error and rollbacks if TxnxFunc is failed.
-// It commits if TxnxFunc is successed.
+// The error of rollback is joined as *RollbackError if rollback is failed too.
+// It commits if TxnxFunc is successed, and returns *CommitError if commit is failed.
+// If TxnxFunc panics, it rollbacks and panics again with the same value.
+// If db implements Manager, the transaction joins the active transaction of it.
 func RunxWithContext(ctx context.Context, opts *sql.TxOptions, db SQLx, f TxnxFunc) error {
-	tx, err := db.BeginTxx(ctx, opts)
+	if m, ok := db.(Manager); ok {
+		return runManaged(ctx, opts, m, func(tx Transaction) error { return f(tx) })
+	}
+	begin := func() (*sqlx.Tx, error) { return db.BeginTxx(ctx, opts) }
+	return run(begin, func(tx *sqlx.Tx) error { return f(tx) })
+}
+
+// RunManaged begins transaction by Manager around TxnxFunc.
+// It is like RunxWithContext but accepts *sqlx.Txm too, so a transaction
+// block can join the transaction which is already began by BeginTxm.
+func RunManaged(ctx context.Context, opts *sql.TxOptions, m Manager, f TxnxFunc) error {
+	return runManaged(ctx, opts, m, func(tx Transaction) error { return f(tx) })
+}
+
+func runManaged(ctx context.Context, opts *sql.TxOptions, m Manager, f func(Transaction) error) error {
+	begin := func() (Transaction, error) { return m.BeginManaged(ctx, opts) }
+	return run(begin, f)
+}
+
+// txn is implemented by *sql.Tx and *sqlx.Tx.
+type txn interface {
+	Commit() error
+	Rollback() error
+}
+
+// run runs f in the transaction which is began by begin.
+// The transaction is rolled back when f is failed, panics or
+// calls runtime.Goexit. It is rolled back too if Commit panics,
+// as *sqlx.Txm does when a nested transaction is rolled back.
+func run[T txn](begin func() (T, error), f func(T) error) error {
+	tx, err := begin()
 	if err != nil {
 		return err
 	}
-	if err := f(tx); err != nil {
+	finished := false
+	defer func() {
+		if finished {
+			return
+		}
+		r := recover()
 		tx.Rollback()
+		if r != nil {
+			panic(r)
+		}
+	}()
+	if err := f(tx); err != nil {
+		finished = true
+		if rerr := tx.Rollback(); rerr != nil && rerr != sql.ErrTxDone {
+			return errors.Join(err, &RollbackError{Err: rerr})
+		}
 		return err
 	}
-	return tx.Commit()
+	err = tx.Commit()
+	finished = true
+	if err != nil {
+		// *sqlx.Txm is still active if it is busy.
+		tx.Rollback()
+		return newCommitError(err)
+	}
+	return nil
 }
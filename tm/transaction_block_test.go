@@ -0,0 +1,76 @@
+package tm
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jmoiron/sqlx"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Person struct {
+	FirstName string `db:"first_name"`
+	LastName  string `db:"last_name"`
+}
+
+func openDB(t *testing.T) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "tm.db"))
+	t.Cleanup(func() { db.Close() })
+	db.MustExec("CREATE TABLE person (first_name text, last_name text)")
+	return db
+}
+
+func TestRunxResult(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	p, err := RunxResult(ctx, nil, db, func(tx Executorx) (Person, error) {
+		tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name) VALUES (?, ?)"), "Code", "Hex")
+		return Get[Person](ctx, tx, "SELECT * FROM person LIMIT 1")
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.FirstName != "Code" || p.LastName != "Hex" {
+		t.Fatalf("unexpected result: %+v", p)
+	}
+
+	people, err := Select[Person](ctx, db, "SELECT * FROM person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(people) != 1 {
+		t.Fatalf("transaction must be committed, but got %d rows", len(people))
+	}
+}
+
+func TestRunResultRollback(t *testing.T) {
+	db := openDB(t)
+	ctx := context.Background()
+
+	n, err := RunResult(ctx, nil, db, func(tx Executor) (int, error) {
+		if _, err := tx.Exec("INSERT INTO person (first_name, last_name) VALUES (?, ?)", "Code", "Hex"); err != nil {
+			return 0, err
+		}
+		var n int
+		if err := tx.QueryRow("SELECT count(*) FROM person").Scan(&n); err != nil {
+			return 0, err
+		}
+		_, err := tx.Exec("INSERT INTO unknown (id) VALUES (1)")
+		return n, err
+	})
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	if n != 0 {
+		t.Fatalf("expected zero value, but got %d", n)
+	}
+	if n, err := Get[int](ctx, db, "SELECT count(*) FROM person"); err != nil || n != 0 {
+		t.Fatalf("transaction must be rolled back: %d, %v", n, err)
+	}
+}
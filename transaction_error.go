@@ -1,5 +1,7 @@
 package sqlx
 
+import "errors"
+
 const (
 	commitErrMsg  = "Tried to commit but already rollbacked in nested transaction"
 	beginTxErrMsg = "Trying to start a transaction in nested state"
@@ -12,3 +14,9 @@ type NestedCommitErr struct{}
 func (n *NestedCommitErr) Error() string {
 	return commitErrMsg
 }
+
+// ErrTxBusy is returned by Commit of the outermost transaction when
+// other goroutines are executing statements in the transaction, or rows
+// of the transaction are not closed. The transaction is not committed,
+// so it can be committed again after them, or rolled back.
+var ErrTxBusy = errors.New("sqlx: transaction is busy with statements or open rows")
@@ -3,6 +3,7 @@ package sqlx
 import (
 	"context"
 	"database/sql"
+	"sync"
 	"sync/atomic"
 
 	sqlxx "github.com/jmoiron/sqlx"
@@ -15,6 +16,19 @@ type DB struct {
 
 	rollbacked *rollbacked
 	activeTx   *activeTx
+
+	stmts *stmtCache
+
+	middlewares []Middleware
+	handler     Handler
+
+	journal bool
+	redact  Redactor
+
+	watch     *watchConfig
+	admission *Admission
+	// beginMu guards beginning the outermost transaction.
+	beginMu sync.Mutex
 }
 
 // Txm is a wrapper around *github.com/jmoiron/sqlx.DB with extra functionality and
@@ -24,6 +38,31 @@ type Txm struct {
 
 	rollbacked *rollbacked
 	activeTx   *activeTx
+
+	mu            sync.Mutex
+	held          map[int64]struct{}
+	beforeEnd     []func()
+	afterEnd      []func()
+	beforeCommit  []func(*Txm) error
+	afterCommit   []func(*Txm)
+	afterRollback []func(*Txm)
+	deferred      []deferredStmt
+	deferErr      error
+	stmts         *stmtCache
+	dbStmts       *stmtCache
+	handler       Handler
+	savepoints    []string
+	journal       *Journal
+	id            uint64
+	label         string
+	watch         *watcher
+	sem           chan struct{}
+	ctx           context.Context
+	group         *txGroup
+	locals        map[string]struct{}
+	ended         uint32
+	conn          *sqlxx.Conn
+	discard       uint32
 }
 
 type activeTx struct{ count uint64 }
@@ -56,9 +95,31 @@ func MustOpen(driverName, dataSourceName string) *DB {
 
 // Close closes *github.com/jmoiron/sqlx.DB
 func (db *DB) Close() error {
+	if db.stmts != nil {
+		db.stmts.close()
+	}
 	return db.DB.Close()
 }
 
+// Detach returns DB which shares connections and settings of db, like
+// middlewares, the journal and the statement cache, but has its own active
+// transaction. Transactions begun by it don't join the active transaction
+// of db, and vice versa. Don't close it, close db instead.
+func (db *DB) Detach() *DB {
+	return &DB{
+		DB:          db.DB,
+		rollbacked:  &rollbacked{},
+		activeTx:    &activeTx{},
+		stmts:       db.stmts,
+		middlewares: append([]Middleware(nil), db.middlewares...),
+		handler:     db.handler,
+		journal:     db.journal,
+		redact:      db.redact,
+		watch:       db.watch,
+		admission:   db.admission,
+	}
+}
+
 // SQL returns *sql.DB
 // The reason for writing this method is that it needs to be
 // written as *db.DB.DB to access *sql.DB.
@@ -66,13 +127,59 @@ func (db *DB) SQL() *sql.DB {
 	return db.DB.DB
 }
 
+// begin begins a transaction on its own connection, so the connection
+// can be discarded when the transaction fails to restore the session
+// state which it changed, like variables of SetLocal.
+func (db *DB) begin(ctx context.Context, opts *sql.TxOptions) (*sqlxx.Tx, *sqlxx.Conn, error) {
+	conn, err := db.Connx(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	tx, err := conn.BeginTxx(ctx, opts)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return tx, conn, nil
+}
+
 // setTx sets *github.com/jmoiron/sqlx.DB into *Txm.
-func (db *DB) setTx(tx *sqlxx.Tx) {
-	db.tx = &Txm{
+func (db *DB) setTx(ctx context.Context, tx *sqlxx.Tx, conn *sqlxx.Conn) {
+	db.tx = newTxm(tx, db.activeTx, db.rollbacked)
+	db.tx.conn = conn
+	db.tx.afterEnd = append(db.tx.afterEnd, db.tx.closeConn)
+	db.tx.ctx = ctx
+	db.tx.id = atomic.AddUint64(&txID, 1)
+	db.tx.label = LabelFromContext(ctx)
+	db.tx.handler = db.handler
+	if db.watch != nil {
+		db.tx.startWatch(db.watch)
+	}
+	if db.journal {
+		db.tx.EnableJournal(db.redact)
+	}
+	if db.stmts != nil {
+		db.tx.dbStmts = db.stmts
+		db.tx.EnableStmtCache(db.stmts.size)
+	}
+}
+
+func newTxm(tx *sqlxx.Tx, a *activeTx, r *rollbacked) *Txm {
+	return &Txm{
 		Tx:         tx,
-		activeTx:   db.activeTx,
-		rollbacked: db.rollbacked,
+		activeTx:   a,
+		rollbacked: r,
+		sem:        make(chan struct{}, 1),
+	}
+}
+
+// Context returns the context which the transaction is begun with.
+// It is context.Background() for BeginTxm.
+func (t *Txm) Context() context.Context {
+	if t.ctx == nil {
+		return context.Background()
 	}
+	return t.ctx
 }
 
 // getTx gets *github.com/jmoiron/sqlx.DB into *Txm.
@@ -85,13 +192,30 @@ func (db *DB) getTxm() *Txm {
 // BeginTxm begins a transaction and returns pointer of transaction manager.
 // Actually, This method will invoke *github.com/jmoiron/sqlx.Beginx().
 // but returns error if failed it.
+//
+// BeginTxm has no context, so it does not set session variables of
+// WithStatementTimeout, WithLockTimeout and WithSessionVars. Use BeginTxmx
+// to set them, or SetLocal in the transaction.
 func (db *DB) BeginTxm() (*Txm, error) {
 	if !db.activeTx.has() {
-		tx, err := db.DB.Beginx()
+		release, err := db.admit(context.Background())
 		if err != nil {
 			return nil, err
 		}
-		db.setTx(tx)
+		db.beginMu.Lock()
+		defer db.beginMu.Unlock()
+		if db.activeTx.has() {
+			// Another transaction began while waiting for admission.
+			release()
+			return db.getTxm(), nil
+		}
+		tx, conn, err := db.begin(context.Background(), nil)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		db.setTx(context.Background(), tx, conn)
+		db.tx.afterEnd = append(db.tx.afterEnd, release)
 		return db.getTxm(), nil
 	}
 	return db.getTxm(), nil
@@ -113,14 +237,38 @@ func (db *DB) MustBeginTxm() *Txm {
 // back. If the context is canceled, the sql package will roll back the
 // transaction. Tx.Commit will return an error if the context provided to
 // BeginxContext is canceled.
+//
+// Session variables given by WithStatementTimeout, WithLockTimeout and
+// WithSessionVars are set when the transaction begins. They are not set
+// when it joins the active transaction, which keeps its own settings.
+//
+// If the admission is set by SetAdmission, it waits for admission until
+// ctx is done. If another transaction begins while waiting, it joins it.
 func (db *DB) BeginTxmx(ctx context.Context, opts *sql.TxOptions) (*Txm, error) {
 	if !db.activeTx.has() {
-		tx, err := db.BeginTxx(ctx, opts)
+		release, err := db.admit(ctx)
 		if err != nil {
 			return nil, err
 		}
-		db.setTx(tx)
-		return db.getTxm(), nil
+		db.beginMu.Lock()
+		defer db.beginMu.Unlock()
+		if db.activeTx.has() {
+			release()
+			return db.getTxm(), nil
+		}
+		tx, conn, err := db.begin(ctx, opts)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		db.setTx(ctx, tx, conn)
+		db.tx.afterEnd = append(db.tx.afterEnd, release)
+		txm := db.getTxm()
+		if err := txm.setSession(ctx); err != nil {
+			txm.Rollback()
+			return nil, err
+		}
+		return txm, nil
 	}
 	return db.getTxm(), nil
 }
@@ -136,24 +284,63 @@ func (db *DB) MustBeginTxmx(ctx context.Context, opts *sql.TxOptions) (*Txm, err
 }
 
 // Commit commits the transaction.
+// The outermost Commit returns ErrTxBusy without committing if other
+// goroutines are executing statements or rows are not closed.
 func (t *Txm) Commit() error {
 	if t.rollbacked.already() {
 		panic(new(NestedCommitErr))
 	}
+	acquired := false
+	if t.activeTx.get() == 1 {
+		// Goroutines started by Go finish before hooks,
+		// and their error rolls back the transaction.
+		if err := t.Wait(); err != nil {
+			t.Rollback()
+			return err
+		}
+		// Hooks run while the transaction is still active,
+		// so they can join it by BeginTxm.
+		if err := t.runBeforeCommit(); err != nil {
+			t.Rollback()
+			return err
+		}
+		// Hooks may have rolled back the nested transaction they joined.
+		if t.rollbacked.already() {
+			t.Rollback()
+			return new(NestedCommitErr)
+		}
+		// Statements of other goroutines must not run while committing.
+		if !t.tryAcquire() {
+			return ErrTxBusy
+		}
+		acquired = true
+	}
 	t.activeTx.decrement()
 	if !t.activeTx.has() {
-		if err := t.Tx.Commit(); err != nil {
+		t.runBeforeEnd()
+		defer t.runAfterEnd()
+		err := t.Tx.Commit()
+		atomic.StoreUint32(&t.ended, 1)
+		if acquired {
+			t.release()
+		}
+		if err != nil {
+			t.runAfterRollback()
 			return err
 		}
 		t.reset()
+		t.runAfterCommit()
 		return nil
 	}
+	if acquired {
+		t.release()
+	}
 	return nil
 }
 
 // Rollback rollbacks the transaction.
 func (t *Txm) Rollback() error {
-	if !t.activeTx.has() {
+	if atomic.LoadUint32(&t.ended) == 1 || !t.activeTx.has() {
 		return nil
 	}
 	t.activeTx.decrement()
@@ -161,7 +348,14 @@ func (t *Txm) Rollback() error {
 		t.rollbacked.increment()
 		return nil
 	}
-	return t.Tx.Rollback()
+	t.stopGroup()
+	t.runBeforeEnd()
+	defer t.runAfterEnd()
+	err := t.Tx.Rollback()
+	atomic.StoreUint32(&t.ended, 1)
+	t.reset()
+	t.runAfterRollback()
+	return err
 }
 
 // In expands slice values in args, returning the modified query string
@@ -171,6 +365,13 @@ func In(query string, args ...interface{}) (string, []interface{}, error) {
 	return sqlxx.In(query, args...)
 }
 
+// active reports whether the transaction is not committed or rolled back.
+// The counter of nested transactions is shared with transactions
+// which are begun by the same DB after this.
+func (t *Txm) active() bool {
+	return atomic.LoadUint32(&t.ended) == 0 && t.activeTx.has()
+}
+
 // reset resets some counter for transaction manager.
 func (t *Txm) reset() {
 	t.rollbacked.reset()
@@ -1,9 +1,11 @@
 package sqlx
 
 import (
+	"context"
 	"fmt"
 	"sync"
 	"testing"
+	"time"
 )
 
 func TestAtomicCount(t *testing.T) {
@@ -55,3 +57,164 @@ func TestAtomicCount(t *testing.T) {
 		tx.reset()
 	})
 }
+
+func TestAtomicStatements(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		insert := tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)")
+		var wg sync.WaitGroup
+		times := 100
+		errs := make(chan error, times)
+		for i := 0; i < times; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				txm, err := db.BeginTxm()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := insertAndCount(txm, insert, i); err != nil {
+					txm.Rollback()
+					errs <- err
+					return
+				}
+				errs <- txm.Commit()
+			}(i)
+		}
+		wg.Wait()
+		close(errs)
+		for err := range errs {
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != times {
+			t.Fatalf("expected %d rows, but got %d", times, n)
+		}
+	})
+}
+
+func TestAtomicOpenRows(t *testing.T) {
+	db := openInterceptedDB(t)
+	tx, err := db.BeginTxm()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	insert := "INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"
+	tx.MustExec(insert, "Jason", "Moiron", "jmoiron@jmoiron.net")
+	tx.MustExec(insert, "John", "Doe", "johndoeDNE@gmail.net")
+
+	// Rows hold the lock until Next reaches the end.
+	rows, err := tx.Queryx("SELECT email FROM person")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tx.ExecContext(ctx, "DELETE FROM person"); err != context.DeadlineExceeded {
+		t.Fatalf("expected context.DeadlineExceeded, but got %v", err)
+	}
+	for rows.Next() {
+	}
+	if _, err := tx.Exec("INSERT INTO secret (value) VALUES ('next')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// And until Close.
+	rows, err = tx.NamedQuery("SELECT email FROM person WHERE first_name = :name", map[string]interface{}{"name": "John"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows.Close()
+	if _, err := tx.Exec("INSERT INTO secret (value) VALUES ('close')"); err != nil {
+		t.Fatal(err)
+	}
+
+	// Failed queries don't hold it.
+	if _, err := tx.Queryx("SELECT * FROM nothing"); err == nil {
+		t.Fatal("query must fail")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	var n int
+	if err := db.Get(&n, "SELECT count(*) FROM secret"); err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 rows, but got %d", n)
+	}
+}
+
+func TestAtomicCommitBusy(t *testing.T) {
+	RunWithSchema(defaultSchema, t, func(db *DB, t *testing.T) {
+		tx, err := db.BeginTxm()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer tx.Rollback()
+
+		// Rows are not closed while committing.
+		rows, err := tx.Queryx("SELECT * FROM person")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != ErrTxBusy {
+			t.Fatalf("expected ErrTxBusy, but got %v", err)
+		}
+		rows.Close()
+
+		// The transaction is still active, and can be committed.
+		if _, err := tx.Exec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Code", "Hex", "x00.x7f@gmail.com"); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+		var n int
+		if err := db.Get(&n, "SELECT count(*) FROM person"); err != nil {
+			t.Fatal(err)
+		}
+		if n != 1 {
+			t.Fatalf("expected 1 row, but got %d", n)
+		}
+	})
+}
+
+func insertAndCount(txm *Txm, insert string, i int) error {
+	if _, err := txm.Exec(insert, "Code", "Hex", fmt.Sprintf("%d@example.com", i)); err != nil {
+		return err
+	}
+	// Other goroutines wait until rows are closed.
+	rows, err := txm.Queryx(txm.Rebind("SELECT email FROM person WHERE email = ?"), fmt.Sprintf("%d@example.com", i))
+	if err != nil {
+		return err
+	}
+	n := 0
+	for rows.Next() {
+		n++
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("goroutine %d must see its own row", i)
+	}
+	return nil
+}
@@ -0,0 +1,183 @@
+package a
+
+import (
+	"context"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	"github.com/Code-Hex/sqlx-transactionmanager/tm"
+)
+
+func good(db *sqlx.DB) error {
+	tx, err := db.BeginTxm()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	rows, err := tx.Queryx("SELECT 1")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+	}
+	return tx.Commit()
+}
+
+func deferredFunc(db *sqlx.DB) error {
+	tx := db.MustBeginTxm()
+	defer func() {
+		tx.Rollback()
+	}()
+	return tx.Commit()
+}
+
+func begin(db *sqlx.DB) (*sqlx.Txm, error) {
+	tx, err := db.BeginTxm()
+	return tx, err
+}
+
+func noRollback(db *sqlx.DB) error {
+	tx, err := db.BeginTxm() // want `transaction tx is not rolled back on return`
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM person"); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func lateDefer(db *sqlx.DB) error {
+	tx := db.MustBeginTxm() // want `transaction tx is not rolled back on return`
+	if _, err := tx.Exec("DELETE FROM person"); err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	return tx.Commit()
+}
+
+func nested(db *sqlx.DB) error {
+	tx, err := db.BeginTxm()
+	if err != nil {
+		return err
+	}
+	tx.Exec("DELETE FROM person")
+	return tx.Commit()
+}
+
+func handOver(db *sqlx.DB, end func(*sqlx.Txm)) {
+	tx := db.MustBeginTxm()
+	end(tx)
+}
+
+func ignoredCommit(db *sqlx.DB) {
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	tx.Commit()       // want `error of Commit is ignored`
+	_ = tx.Commit()   // want `error of Commit is ignored`
+	defer tx.Commit() // want `error of Commit is ignored`
+}
+
+func mustBegin(ctx context.Context, db *sqlx.DB) error {
+	tx, _ := db.MustBeginTxmx(ctx, nil) // want `MustBeginTxmx panics instead of returning error`
+	defer tx.Rollback()
+	return tx.Commit()
+}
+
+func rowsOpen(db *sqlx.DB) error {
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	rows, err := tx.Queryx("SELECT 1")
+	if err != nil {
+		return err
+	}
+	if rows.Next() {
+	}
+	return tx.Commit() // want `rows rows are not closed before Commit`
+}
+
+func rowsAfterCommit(db *sqlx.DB) error {
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	rows, err := tx.Queryx("SELECT 1")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	if rows.Next() {
+	}
+	if err := tx.Commit(); err != nil { // want `rows rows are not closed before Commit`
+		return err
+	}
+	for rows.Next() { // want `rows rows are read after Commit`
+	}
+	return rows.Err()
+}
+
+func rowsBreak(db *sqlx.DB) error {
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	rows, err := tx.Queryx("SELECT 1")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		break
+	}
+	return tx.Commit() // want `rows rows are not closed before Commit`
+}
+
+func rowsClosed(db *sqlx.DB) error {
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	rows, err := tx.Queryx("SELECT 1")
+	if err != nil {
+		return err
+	}
+	for rows.Next() {
+		for {
+			break
+		}
+	}
+	rows, err = tx.Queryx("SELECT 2")
+	if err != nil {
+		return err
+	}
+	rows.Close()
+	return tx.Commit()
+}
+
+func mustExec(db *sqlx.DB) error {
+	tx := db.MustBeginTxm() // want `transaction tx is not rolled back on return or panic`
+	tx.MustExec("DELETE FROM person")
+	return tx.Commit()
+}
+
+func fallThrough(db *sqlx.DB) {
+	tx := db.MustBeginTxm() // want `transaction tx is not rolled back on return or panic`
+	tx.Exec("DELETE FROM person")
+}
+
+func ignored(db *sqlx.DB) {
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	tx.Commit() //txmcheck:ignore
+	//txmcheck:ignore
+	tx.Commit()
+}
+
+func outerDB(db *sqlx.DB) error {
+	return tm.Runx(db, func(tx tm.Executorx) error {
+		if _, err := tx.Exec("DELETE FROM person"); err != nil {
+			return err
+		}
+		var n int
+		return db.Get(&n, "SELECT count(*) FROM person") // want `db.Get runs outside of the transaction`
+	})
+}
+
+func outerDBResult(ctx context.Context, db *sqlx.DB) (int, error) {
+	return tm.RunxResult(ctx, nil, db, func(tx tm.Executorx) (int, error) {
+		_, err := db.Exec("DELETE FROM person") // want `db.Exec runs outside of the transaction`
+		return 0, err
+	})
+}
@@ -0,0 +1,24 @@
+package sqlx
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type DB struct{}
+
+func (*DB) BeginTxm() (*Txm, error)                                  { return nil, nil }
+func (*DB) BeginTxmx(context.Context, interface{}) (*Txm, error)     { return nil, nil }
+func (*DB) MustBeginTxm() *Txm                                       { return nil }
+func (*DB) MustBeginTxmx(context.Context, interface{}) (*Txm, error) { return nil, nil }
+func (*DB) Exec(string, ...interface{}) (sqlx.Result, error)         { return nil, nil }
+func (*DB) Get(interface{}, string, ...interface{}) error            { return nil }
+
+type Txm struct{}
+
+func (*Txm) Commit() error                                     { return nil }
+func (*Txm) Rollback() error                                   { return nil }
+func (*Txm) Exec(string, ...interface{}) (sqlx.Result, error)  { return nil, nil }
+func (*Txm) Queryx(string, ...interface{}) (*sqlx.Rows, error) { return nil, nil }
+func (*Txm) MustExec(string, ...interface{}) sqlx.Result       { return nil }
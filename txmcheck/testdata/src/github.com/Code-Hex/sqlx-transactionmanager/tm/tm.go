@@ -0,0 +1,20 @@
+package tm
+
+import (
+	"context"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Executorx interface {
+	Exec(string, ...interface{}) (sqlx.Result, error)
+}
+
+type SQLx interface{}
+
+func Runx(db SQLx, f func(Executorx) error) error { return nil }
+
+func RunxResult[T any](ctx context.Context, opts interface{}, db SQLx, f func(Executorx) (T, error)) (T, error) {
+	var v T
+	return v, nil
+}
@@ -0,0 +1,537 @@
+// Package txmcheck defines an Analyzer which reports misuse of
+// transactions of github.com/Code-Hex/sqlx-transactionmanager.
+//
+// It reports:
+//
+//   - transactions begun by BeginTxm and friends which leak on returns,
+//     panics or the end of the function, because they are not rolled
+//     back by defer
+//   - errors of Commit which are ignored
+//   - the error of MustBeginTxmx which is ignored, since it panics
+//     instead of returning an error
+//   - statements executed by the outer DB instead of the transaction
+//     inside blocks of tm.Run and friends
+//   - rows of the transaction which are not closed before Commit,
+//     which returns ErrTxBusy then, or read after Commit
+//
+// Test files are not checked. Reports are suppressed by
+// a //txmcheck:ignore comment on the line or the line before.
+//
+// The analyzer can be run by go vet:
+//
+//	go install github.com/Code-Hex/sqlx-transactionmanager/cmd/txmcheck
+//	go vet -vettool=$(which txmcheck) ./...
+package txmcheck
+
+import (
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strings"
+
+	"golang.org/x/tools/go/analysis"
+	"golang.org/x/tools/go/analysis/passes/inspect"
+	"golang.org/x/tools/go/ast/inspector"
+	"golang.org/x/tools/go/types/typeutil"
+)
+
+const (
+	pkgPath   = "github.com/Code-Hex/sqlx-transactionmanager"
+	tmPath    = pkgPath + "/tm"
+	sqlxPath  = "github.com/jmoiron/sqlx"
+	sqlPath   = "database/sql"
+	docString = `report misuse of transactions of sqlx-transactionmanager
+
+txmcheck reports transactions which are not rolled back by defer,
+ignored errors of Commit and MustBeginTxmx, statements executed by the
+outer DB in tm.Run blocks, and rows which are open at Commit or read
+after it. Reports are suppressed by a //txmcheck:ignore comment.`
+)
+
+// Analyzer reports misuse of transactions.
+var Analyzer = &analysis.Analyzer{
+	Name:     "txmcheck",
+	Doc:      docString,
+	Requires: []*analysis.Analyzer{inspect.Analyzer},
+	Run:      run,
+}
+
+func run(pass *analysis.Pass) (interface{}, error) {
+	inspect := pass.ResultOf[inspect.Analyzer].(*inspector.Inspector)
+	nodes := []ast.Node{
+		(*ast.FuncDecl)(nil),
+		(*ast.FuncLit)(nil),
+		(*ast.ExprStmt)(nil),
+		(*ast.DeferStmt)(nil),
+		(*ast.AssignStmt)(nil),
+		(*ast.CallExpr)(nil),
+	}
+	inspect.Preorder(nodes, func(n ast.Node) {
+		switch n := n.(type) {
+		case *ast.FuncDecl:
+			if n.Body != nil {
+				checkFunc(pass, n.Body)
+			}
+		case *ast.FuncLit:
+			checkFunc(pass, n.Body)
+		case *ast.ExprStmt:
+			if call, ok := n.X.(*ast.CallExpr); ok && isMethod(pass, call, pkgPath, "Txm", "Commit") {
+				report(pass, call.Pos(), "error of Commit is ignored")
+			}
+		case *ast.DeferStmt:
+			if isMethod(pass, n.Call, pkgPath, "Txm", "Commit") {
+				report(pass, n.Call.Pos(), "error of Commit is ignored")
+			}
+		case *ast.AssignStmt:
+			checkAssign(pass, n)
+		case *ast.CallExpr:
+			checkRunBlock(pass, n)
+		}
+	})
+	return nil, nil
+}
+
+// checkAssign reports ignored errors of Commit and MustBeginTxmx.
+func checkAssign(pass *analysis.Pass, as *ast.AssignStmt) {
+	if len(as.Rhs) != 1 {
+		return
+	}
+	call, ok := as.Rhs[0].(*ast.CallExpr)
+	if !ok {
+		return
+	}
+	switch {
+	case isMethod(pass, call, pkgPath, "Txm", "Commit"):
+		if len(as.Lhs) == 1 && isBlank(as.Lhs[0]) {
+			report(pass, call.Pos(), "error of Commit is ignored")
+		}
+	case isMethod(pass, call, pkgPath, "DB", "MustBeginTxmx"):
+		if len(as.Lhs) == 2 && isBlank(as.Lhs[1]) {
+			report(pass, call.Pos(), "MustBeginTxmx panics instead of returning error, so ignoring the error hides the intent; use BeginTxmx and check the error")
+		}
+	}
+}
+
+var beginMethods = []string{"BeginTxm", "BeginTxmx", "MustBeginTxm", "MustBeginTxmx"}
+
+// checkFunc checks transactions and rows in body. Function literals in
+// body are checked by themselves.
+//
+// A transaction leaks if it is not rolled back by defer before the
+// function may leave it: by returns, by calls which may panic, like
+// MustExec, or by reaching the end without committing or rolling back.
+// Returns checking the error of the begin are not counted, and the
+// transaction is safe after the first Commit or Rollback, so nested
+// transactions which are committed in the end don't need defer.
+// Transactions which are returned or handed to others are not reported,
+// because they may be ended by them.
+func checkFunc(pass *analysis.Pass, body *ast.BlockStmt) {
+	type txVar struct {
+		obj  types.Object
+		err  types.Object
+		call *ast.CallExpr
+		lhs  []ast.Expr
+	}
+	type rowsVar struct {
+		obj types.Object
+		tx  types.Object
+		pos token.Pos
+		lhs []ast.Expr
+	}
+	type commit struct {
+		tx  types.Object
+		pos token.Pos
+	}
+	var (
+		txs       []txVar
+		rows      []rowsVar
+		commits   []commit
+		reads     = make(map[types.Object][]*ast.CallExpr)
+		ends      = make(map[types.Object][]token.Pos)
+		guards    = make(map[types.Object][]token.Pos)
+		closes    = make(map[types.Object][]token.Pos)
+		loops     = make(map[types.Object][]*ast.ForStmt)
+		exits     []ast.Node
+		errIfs    []*ast.IfStmt
+		receivers = make(map[*ast.Ident]bool)
+	)
+	inspectFunc(body, func(n ast.Node, inDefer bool) {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			if len(n.Rhs) != 1 || len(n.Lhs) == 0 {
+				return
+			}
+			call, ok := n.Rhs[0].(*ast.CallExpr)
+			if !ok {
+				return
+			}
+			obj := objectOf(pass, n.Lhs[0])
+			if obj == nil {
+				return
+			}
+			for _, m := range beginMethods {
+				if isMethod(pass, call, pkgPath, "DB", m) {
+					tx := txVar{obj: obj, call: call, lhs: n.Lhs}
+					if len(n.Lhs) == 2 {
+						tx.err = objectOf(pass, n.Lhs[1])
+					}
+					txs = append(txs, tx)
+				}
+			}
+			if isRowsCall(pass, call) {
+				if sel, ok := call.Fun.(*ast.SelectorExpr); ok {
+					rows = append(rows, rowsVar{obj, objectOf(pass, sel.X), n.Pos(), n.Lhs})
+				}
+			}
+		case *ast.IfStmt:
+			errIfs = append(errIfs, n)
+		case *ast.ForStmt:
+			if call, ok := n.Cond.(*ast.CallExpr); ok && !hasBreak(n.Body) {
+				if sel, ok := call.Fun.(*ast.SelectorExpr); ok && sel.Sel.Name == "Next" {
+					if obj := objectOf(pass, sel.X); obj != nil {
+						loops[obj] = append(loops[obj], n)
+					}
+				}
+			}
+		case *ast.ReturnStmt:
+			if !inDefer {
+				exits = append(exits, n)
+			}
+		case *ast.SelectorExpr:
+			if id, ok := unparen(n.X).(*ast.Ident); ok {
+				receivers[id] = true
+			}
+		case *ast.CallExpr:
+			if id, ok := n.Fun.(*ast.Ident); ok && id.Name == "panic" && !inDefer {
+				if _, ok := pass.TypesInfo.Uses[id].(*types.Builtin); ok {
+					exits = append(exits, n)
+				}
+			}
+			sel, ok := n.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return
+			}
+			if strings.HasPrefix(sel.Sel.Name, "Must") && !inDefer {
+				exits = append(exits, n)
+			}
+			obj := objectOf(pass, sel.X)
+			if obj == nil {
+				return
+			}
+			switch {
+			case isMethod(pass, n, pkgPath, "Txm", "Rollback") && inDefer:
+				guards[obj] = append(guards[obj], n.Pos())
+			case isMethod(pass, n, pkgPath, "Txm", "Rollback"):
+				ends[obj] = append(ends[obj], n.Pos())
+			case isMethod(pass, n, pkgPath, "Txm", "Commit") && !inDefer:
+				ends[obj] = append(ends[obj], n.Pos())
+				commits = append(commits, commit{obj, n.Pos()})
+			case sel.Sel.Name == "Close" && !inDefer:
+				closes[obj] = append(closes[obj], n.Pos())
+			case readsRows[sel.Sel.Name] && !inDefer:
+				reads[obj] = append(reads[obj], n)
+			}
+		}
+	})
+	// escapes reports whether obj is used other than as the receiver,
+	// like returned, passed or captured by function literals.
+	escapes := func(obj types.Object, lhs []ast.Expr) bool {
+		defs := make(map[ast.Node]bool)
+		for _, e := range lhs {
+			defs[unparen(e)] = true
+		}
+		escaped := false
+		ast.Inspect(body, func(n ast.Node) bool {
+			id, ok := n.(*ast.Ident)
+			if ok && !defs[id] && !receivers[id] && pass.TypesInfo.ObjectOf(id) == obj {
+				escaped = true
+			}
+			return !escaped
+		})
+		return escaped
+	}
+
+	for _, tx := range txs {
+		if escapes(tx.obj, tx.lhs) {
+			continue
+		}
+		// The transaction is safe after the first end or defer of it.
+		safe := first(ends[tx.obj], tx.call.End())
+		if g := first(guards[tx.obj], tx.call.End()); g != token.NoPos && (safe == token.NoPos || g < safe) {
+			safe = g
+		}
+		leaks := safe == token.NoPos
+		errIf := beginErrCheck(pass, errIfs, tx.err, tx.call.End())
+		for _, e := range exits {
+			if leaks || e.Pos() < tx.call.End() || e.End() > safe {
+				continue
+			}
+			if errIf != nil && errIf.Pos() <= e.Pos() && e.End() <= errIf.End() {
+				continue
+			}
+			leaks = true
+		}
+		if leaks {
+			report(pass, tx.call.Pos(), "transaction %s is not rolled back on return or panic; call defer %s.Rollback() after it begins", tx.obj.Name(), tx.obj.Name())
+		}
+	}
+	// Commit returns ErrTxBusy while rows of the transaction are open,
+	// and rows which are closed by Commit can't be read after it.
+	for _, r := range rows {
+		if escapes(r.obj, r.lhs) {
+			continue
+		}
+		for _, c := range commits {
+			if r.tx != c.tx || r.pos > c.pos {
+				continue
+			}
+			closed := false
+			for _, pos := range closes[r.obj] {
+				closed = closed || (r.pos < pos && pos < c.pos)
+			}
+			for _, loop := range loops[r.obj] {
+				closed = closed || (r.pos < loop.Pos() && loop.End() < c.pos)
+			}
+			if !closed {
+				report(pass, c.pos, "rows %s are not closed before Commit; close them or read them to the end", r.obj.Name())
+			}
+			for _, read := range reads[r.obj] {
+				if read.Pos() > c.pos {
+					report(pass, read.Pos(), "rows %s are read after Commit; read them before Commit", r.obj.Name())
+				}
+			}
+		}
+	}
+}
+
+// first returns the first position after pos, or token.NoPos.
+func first(positions []token.Pos, pos token.Pos) token.Pos {
+	found := token.NoPos
+	for _, p := range positions {
+		if p > pos && (found == token.NoPos || p < found) {
+			found = p
+		}
+	}
+	return found
+}
+
+// hasBreak reports whether body may break out of its loop.
+func hasBreak(body *ast.BlockStmt) bool {
+	found := false
+	var walk func(root ast.Node, nested bool)
+	walk = func(root ast.Node, nested bool) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case *ast.BranchStmt:
+				// Labeled breaks in inner statements may break the loop.
+				if n.Tok == token.GOTO || n.Tok == token.BREAK && (!nested || n.Label != nil) {
+					found = true
+				}
+			case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+				if !nested && n != root {
+					walk(n, true)
+					return false
+				}
+			case *ast.FuncLit:
+				return false
+			}
+			return !found
+		})
+	}
+	walk(body, false)
+	return found
+}
+
+// readsRows are methods which read rows.
+var readsRows = map[string]bool{
+	"Next": true, "NextResultSet": true, "Scan": true, "StructScan": true, "MapScan": true, "SliceScan": true,
+}
+
+// beginErrCheck returns the first if statement after pos which checks err.
+func beginErrCheck(pass *analysis.Pass, ifs []*ast.IfStmt, err types.Object, pos token.Pos) *ast.IfStmt {
+	if err == nil {
+		return nil
+	}
+	var first *ast.IfStmt
+	for _, n := range ifs {
+		if n.Pos() < pos || (first != nil && n.Pos() > first.Pos()) {
+			continue
+		}
+		cond, ok := n.Cond.(*ast.BinaryExpr)
+		if ok && cond.Op == token.NEQ && objectOf(pass, cond.X) == err {
+			first = n
+		}
+	}
+	return first
+}
+
+// inspectFunc calls f for nodes in body except function literals,
+// and reports whether nodes are in defer statements.
+func inspectFunc(body *ast.BlockStmt, f func(n ast.Node, inDefer bool)) {
+	var walk func(n ast.Node, inDefer bool)
+	walk = func(root ast.Node, inDefer bool) {
+		ast.Inspect(root, func(n ast.Node) bool {
+			switch n := n.(type) {
+			case nil:
+				return false
+			case *ast.FuncLit:
+				// Deferred function literals run at the end of the function.
+				if inDefer {
+					walk(n.Body, true)
+				}
+				return false
+			case *ast.DeferStmt:
+				walk(n.Call, true)
+				return false
+			}
+			f(n, inDefer)
+			return true
+		})
+	}
+	walk(body, false)
+}
+
+var rowsMethods = []string{"Query", "QueryContext", "Queryx", "QueryxContext", "NamedQuery", "NamedQueryContext"}
+
+// isRowsCall reports whether call returns rows of Txm.
+func isRowsCall(pass *analysis.Pass, call *ast.CallExpr) bool {
+	for _, m := range rowsMethods {
+		if isMethod(pass, call, pkgPath, "Txm", m) {
+			return true
+		}
+	}
+	return false
+}
+
+var runFuncs = map[string]bool{
+	"Run": true, "RunWithContext": true, "Runx": true, "RunxWithContext": true, "RunManaged": true,
+	"RunResult": true, "RunxResult": true,
+}
+
+var statementPrefixes = []string{"Exec", "MustExec", "NamedExec", "Query", "NamedQuery", "Get", "Select", "Prepare"}
+
+// checkRunBlock reports statements executed by the outer DB
+// in blocks of tm.Run and friends.
+func checkRunBlock(pass *analysis.Pass, call *ast.CallExpr) {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Pkg() == nil || fn.Pkg().Path() != tmPath || !runFuncs[fn.Name()] {
+		return
+	}
+	block, ok := call.Args[len(call.Args)-1].(*ast.FuncLit)
+	if !ok {
+		return
+	}
+	ast.Inspect(block.Body, func(n ast.Node) bool {
+		c, ok := n.(*ast.CallExpr)
+		if !ok {
+			return true
+		}
+		sel, ok := c.Fun.(*ast.SelectorExpr)
+		if !ok || !isStatement(sel.Sel.Name) || !isDB(pass.TypesInfo.TypeOf(sel.X)) {
+			return true
+		}
+		obj := objectOf(pass, sel.X)
+		if obj == nil || (block.Pos() <= obj.Pos() && obj.Pos() < block.End()) {
+			return true
+		}
+		report(pass, c.Pos(), "%s.%s runs outside of the transaction; use the transaction of the block instead", obj.Name(), sel.Sel.Name)
+		return true
+	})
+}
+
+func isStatement(name string) bool {
+	for _, p := range statementPrefixes {
+		if strings.HasPrefix(name, p) {
+			return true
+		}
+	}
+	return false
+}
+
+// isDB reports whether t is *DB of this package, sqlx or database/sql.
+func isDB(t types.Type) bool {
+	ptr, ok := t.(*types.Pointer)
+	if !ok {
+		return false
+	}
+	named, ok := ptr.Elem().(*types.Named)
+	if !ok || named.Obj().Pkg() == nil || named.Obj().Name() != "DB" {
+		return false
+	}
+	switch named.Obj().Pkg().Path() {
+	case pkgPath, sqlxPath, sqlPath:
+		return true
+	}
+	return false
+}
+
+// isMethod reports whether call calls the method of the named type in pkg.
+// Methods promoted from embedded fields are not matched.
+func isMethod(pass *analysis.Pass, call *ast.CallExpr, pkg, typ, method string) bool {
+	fn, ok := typeutil.Callee(pass.TypesInfo, call).(*types.Func)
+	if !ok || fn.Name() != method || fn.Pkg() == nil || fn.Pkg().Path() != pkg {
+		return false
+	}
+	recv := fn.Type().(*types.Signature).Recv()
+	if recv == nil {
+		return false
+	}
+	t := recv.Type()
+	if ptr, ok := t.(*types.Pointer); ok {
+		t = ptr.Elem()
+	}
+	named, ok := t.(*types.Named)
+	return ok && named.Obj().Name() == typ
+}
+
+func objectOf(pass *analysis.Pass, e ast.Expr) types.Object {
+	id, ok := unparen(e).(*ast.Ident)
+	if !ok || id.Name == "_" {
+		return nil
+	}
+	return pass.TypesInfo.ObjectOf(id)
+}
+
+func isBlank(e ast.Expr) bool {
+	id, ok := e.(*ast.Ident)
+	return ok && id.Name == "_"
+}
+
+func unparen(e ast.Expr) ast.Expr {
+	for {
+		p, ok := e.(*ast.ParenExpr)
+		if !ok {
+			return e
+		}
+		e = p.X
+	}
+}
+
+// ignoreDirective suppresses reports on the line of it or the next line.
+const ignoreDirective = "//txmcheck:ignore"
+
+// report reports the misuse at pos. Test files are not reported, because
+// tests leave transactions and errors to fail the test.
+func report(pass *analysis.Pass, pos token.Pos, format string, args ...interface{}) {
+	position := pass.Fset.Position(pos)
+	if strings.HasSuffix(position.Filename, "_test.go") {
+		return
+	}
+	line := position.Line
+	for _, f := range pass.Files {
+		if f.Pos() > pos || pos > f.End() {
+			continue
+		}
+		for _, cg := range f.Comments {
+			for _, c := range cg.List {
+				if !strings.HasPrefix(c.Text, ignoreDirective) {
+					continue
+				}
+				if l := pass.Fset.Position(c.Pos()).Line; l == line || l == line-1 {
+					return
+				}
+			}
+		}
+	}
+	pass.Reportf(pos, format, args...)
+}
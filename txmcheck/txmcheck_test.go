@@ -0,0 +1,12 @@
+package txmcheck_test
+
+import (
+	"testing"
+
+	"github.com/Code-Hex/sqlx-transactionmanager/txmcheck"
+	"golang.org/x/tools/go/analysis/analysistest"
+)
+
+func TestAnalyzer(t *testing.T) {
+	analysistest.Run(t, analysistest.TestData(), txmcheck.Analyzer, "a")
+}
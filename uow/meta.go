@@ -0,0 +1,144 @@
+package uow
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// column is a column of the table which is mapped to a field of the entity.
+type column struct {
+	name  string
+	index []int
+	pk    bool
+	auto  bool
+}
+
+// meta is the table mapping of an entity type.
+type meta struct {
+	typ     reflect.Type
+	table   string
+	deps    []string
+	columns []column
+}
+
+// newMeta builds the mapping of the type of e by the mapper of the transaction,
+// so the columns are the same as the columns which are scanned by Get or Select.
+func newMeta(m *reflectx.Mapper, e Entity) (*meta, error) {
+	v := reflect.ValueOf(e)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("uow: entity must be a non-nil pointer to struct, but got %T", e)
+	}
+	md := &meta{
+		typ:   v.Type(),
+		table: e.TableName(),
+	}
+	if d, ok := e.(Dependent); ok {
+		md.deps = d.DependsOn()
+	}
+	for _, fi := range m.TypeMap(v.Type()).Index {
+		if fi.Embedded || fi.Name == "" || strings.Contains(fi.Path, ".") {
+			continue
+		}
+		_, pk := fi.Options["pk"]
+		_, auto := fi.Options["auto"]
+		md.columns = append(md.columns, column{
+			name:  fi.Name,
+			index: fi.Index,
+			pk:    pk || auto,
+			auto:  auto,
+		})
+	}
+	if len(md.columns) == 0 {
+		return nil, fmt.Errorf("uow: %T has no columns", e)
+	}
+	return md, nil
+}
+
+// pks returns the primary key columns.
+func (md *meta) pks() []column {
+	var cols []column
+	for _, c := range md.columns {
+		if c.pk {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// insertable returns the columns which are written by INSERT.
+// The auto incremented column is assigned by the database.
+func (md *meta) insertable() []column {
+	var cols []column
+	for _, c := range md.columns {
+		if !c.auto {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// updatable returns the columns which are written by UPDATE.
+func (md *meta) updatable() []column {
+	var cols []column
+	for _, c := range md.columns {
+		if !c.pk {
+			cols = append(cols, c)
+		}
+	}
+	return cols
+}
+
+// autoColumn returns the auto incremented column if exists.
+func (md *meta) autoColumn() (column, bool) {
+	for _, c := range md.columns {
+		if c.auto {
+			return c, true
+		}
+	}
+	return column{}, false
+}
+
+// values appends the values of cols of e to args.
+func values(args []interface{}, e Entity, cols []column) []interface{} {
+	v := reflect.Indirect(reflect.ValueOf(e))
+	for _, c := range cols {
+		args = append(args, reflectx.FieldByIndexesReadOnly(v, c.index).Interface())
+	}
+	return args
+}
+
+// field returns the addressable field of c in e.
+func field(e Entity, c column) reflect.Value {
+	return reflectx.FieldByIndexes(reflect.Indirect(reflect.ValueOf(e)), c.index)
+}
+
+// setID sets id which is generated by the database into the field of c.
+func setID(e Entity, c column, id int64) error {
+	f := field(e, c)
+	switch f.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		f.SetInt(id)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		f.SetUint(uint64(id))
+	default:
+		return fmt.Errorf("uow: cannot set id into %s of %T", c.name, e)
+	}
+	return nil
+}
+
+// names returns the names of cols joined by sep.
+func names(cols []column, format, sep string) string {
+	s := make([]string, len(cols))
+	for i, c := range cols {
+		s[i] = fmt.Sprintf(format, c.name)
+	}
+	return strings.Join(s, sep)
+}
+
+// placeholders returns n placeholders joined by comma.
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
@@ -0,0 +1,420 @@
+// Package uow provides the unit of work on a transaction of
+// github.com/Code-Hex/sqlx-transactionmanager.
+//
+// Entities are structs with db tags, the same as the structs which are
+// scanned by Get or Select. Domain code registers new, dirty and removed
+// entities instead of issuing SQL directly, and the unit of work writes
+// them just before the transaction is committed.
+//
+//	type Person struct {
+//		ID        int64  `db:"id,auto"`
+//		FirstName string `db:"first_name"`
+//	}
+//
+//	func (*Person) TableName() string { return "person" }
+//
+// The pk option marks primary key columns, and the auto option marks the
+// column which is assigned by the database on INSERT.
+//
+// The auto column is set to the entity after the unit of work is flushed,
+// so a new entity cannot refer to the generated id of another new entity
+// of the same unit. Insert the parent and Flush before registering its
+// children, or use ids which are not generated by the database.
+package uow
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+)
+
+// Entity is a row of the table.
+// It must be a pointer to struct.
+type Entity interface {
+	TableName() string
+}
+
+// Dependent is implemented by entities which reference other tables.
+// Rows of the referenced tables are inserted before, and deleted after
+// rows of the table.
+type Dependent interface {
+	DependsOn() []string
+}
+
+var (
+	// ErrRemoved is returned when a removed entity is registered again.
+	ErrRemoved = errors.New("uow: entity is already removed")
+	// ErrNoPrimaryKey is returned when an entity without pk columns
+	// is updated or removed.
+	ErrNoPrimaryKey = errors.New("uow: entity has no primary key")
+)
+
+type state int
+
+const (
+	stateNew state = iota
+	stateDirty
+	stateRemoved
+	stateDropped
+)
+
+type entry struct {
+	entity Entity
+	state  state
+}
+
+// UnitOfWork tracks changes of entities in a transaction.
+type UnitOfWork struct {
+	txm *sqlx.Txm
+
+	mu      sync.Mutex
+	entries []*entry
+	index   map[Entity]*entry
+}
+
+// units holds the unit of work of each active transaction.
+var units sync.Map
+
+// From returns the unit of work of txm. The same unit of work is returned
+// for nested transactions, and it is flushed when the outermost Commit is
+// called. Registered changes are discarded when the transaction is rolled back.
+func From(txm *sqlx.Txm) *UnitOfWork {
+	if u, ok := units.Load(txm); ok {
+		return u.(*UnitOfWork)
+	}
+	u := &UnitOfWork{
+		txm:   txm,
+		index: map[Entity]*entry{},
+	}
+	if actual, loaded := units.LoadOrStore(txm, u); loaded {
+		return actual.(*UnitOfWork)
+	}
+	txm.BeforeCommit(func(t *sqlx.Txm) error {
+		return u.Flush(t.Context())
+	})
+	forget := func(*sqlx.Txm) { units.Delete(txm) }
+	txm.AfterCommit(forget)
+	txm.AfterRollback(forget)
+	return u
+}
+
+// RegisterNew registers e which is inserted.
+func (u *UnitOfWork) RegisterNew(e Entity) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ent, ok := u.index[e]; ok {
+		if ent.state == stateRemoved {
+			return ErrRemoved
+		}
+		return nil
+	}
+	u.add(e, stateNew)
+	return nil
+}
+
+// RegisterDirty registers e which is updated by the primary key.
+// It is no-op if e is registered as new, because fields of e are read
+// when the unit of work is flushed.
+func (u *UnitOfWork) RegisterDirty(e Entity) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ent, ok := u.index[e]; ok {
+		if ent.state == stateRemoved {
+			return ErrRemoved
+		}
+		return nil
+	}
+	u.add(e, stateDirty)
+	return nil
+}
+
+// RegisterRemoved registers e which is deleted by the primary key.
+// If e is registered as new, it is just forgotten.
+func (u *UnitOfWork) RegisterRemoved(e Entity) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if ent, ok := u.index[e]; ok {
+		if ent.state == stateNew {
+			ent.state = stateDropped
+			delete(u.index, e)
+			return nil
+		}
+		ent.state = stateRemoved
+		return nil
+	}
+	u.add(e, stateRemoved)
+	return nil
+}
+
+func (u *UnitOfWork) add(e Entity, s state) {
+	ent := &entry{entity: e, state: s}
+	u.entries = append(u.entries, ent)
+	u.index[e] = ent
+}
+
+// Flush writes registered changes in the transaction. Rows are inserted and
+// updated in dependency order of tables, and deleted in reverse order.
+// Rows of the same table are inserted by multi-row INSERT where possible.
+//
+// Flush is called before commit, but it can be called to read changes
+// by queries in the transaction. The changes are forgotten even if Flush
+// fails, so the transaction should be rolled back in that case.
+func (u *UnitOfWork) Flush(ctx context.Context) error {
+	u.mu.Lock()
+	entries := u.entries
+	u.entries, u.index = nil, map[Entity]*entry{}
+	u.mu.Unlock()
+	if len(entries) == 0 {
+		return nil
+	}
+
+	f := &flusher{txm: u.txm}
+	groups, err := f.group(entries)
+	if err != nil {
+		return err
+	}
+	for _, g := range groups {
+		if err := f.insert(ctx, g); err != nil {
+			return err
+		}
+	}
+	for _, g := range groups {
+		if err := f.update(ctx, g); err != nil {
+			return err
+		}
+	}
+	for i := len(groups) - 1; i >= 0; i-- {
+		if err := f.delete(ctx, groups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// group is entries of the same type.
+type group struct {
+	meta                   *meta
+	inserts, updates, dels []Entity
+}
+
+type flusher struct {
+	txm *sqlx.Txm
+}
+
+// group groups entries by type, and sorts groups in dependency order of tables.
+func (f *flusher) group(entries []*entry) ([]*group, error) {
+	var (
+		groups []*group
+		byType = map[reflect.Type]*group{}
+	)
+	for _, ent := range entries {
+		if ent.state == stateDropped {
+			continue
+		}
+		md, err := newMeta(f.txm.Mapper, ent.entity)
+		if err != nil {
+			return nil, err
+		}
+		g, ok := byType[md.typ]
+		if !ok {
+			g = &group{meta: md}
+			byType[md.typ] = g
+			groups = append(groups, g)
+		}
+		switch ent.state {
+		case stateNew:
+			g.inserts = append(g.inserts, ent.entity)
+		case stateDirty:
+			g.updates = append(g.updates, ent.entity)
+		case stateRemoved:
+			g.dels = append(g.dels, ent.entity)
+		}
+	}
+	return sortGroups(groups)
+}
+
+// sortGroups sorts groups topologically by dependencies of tables.
+// Groups keep the order of registration if they do not depend on each other.
+func sortGroups(groups []*group) ([]*group, error) {
+	byTable := map[string][]*group{}
+	var tables []string
+	for _, g := range groups {
+		if _, ok := byTable[g.meta.table]; !ok {
+			tables = append(tables, g.meta.table)
+		}
+		byTable[g.meta.table] = append(byTable[g.meta.table], g)
+	}
+
+	const (
+		visiting = 1
+		visited  = 2
+	)
+	var (
+		sorted []*group
+		marks  = map[string]int{}
+		visit  func(table string) error
+	)
+	visit = func(table string) error {
+		switch marks[table] {
+		case visiting:
+			return fmt.Errorf("uow: cyclic dependency of table %s", table)
+		case visited:
+			return nil
+		}
+		marks[table] = visiting
+		for _, g := range byTable[table] {
+			for _, dep := range g.meta.deps {
+				if _, ok := byTable[dep]; !ok || dep == table {
+					continue
+				}
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+		marks[table] = visited
+		sorted = append(sorted, byTable[table]...)
+		return nil
+	}
+	for _, table := range tables {
+		if err := visit(table); err != nil {
+			return nil, err
+		}
+	}
+	return sorted, nil
+}
+
+func (f *flusher) insert(ctx context.Context, g *group) error {
+	if len(g.inserts) == 0 {
+		return nil
+	}
+	md := g.meta
+	cols := md.insertable()
+	if auto, ok := md.autoColumn(); ok {
+		// Each row is inserted one by one to get the generated id.
+		for _, e := range g.inserts {
+			if err := f.insertAuto(ctx, md, cols, auto, e); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	n := f.txm.Dialect().MaxParams() / len(cols)
+	row := "(" + placeholders(len(cols)) + ")"
+	for len(g.inserts) > 0 {
+		chunk := g.inserts
+		if len(chunk) > n {
+			chunk = chunk[:n]
+		}
+		g.inserts = g.inserts[len(chunk):]
+
+		rows := make([]string, len(chunk))
+		args := make([]interface{}, 0, len(chunk)*len(cols))
+		for i, e := range chunk {
+			rows[i] = row
+			args = values(args, e, cols)
+		}
+		query := fmt.Sprintf("INSERT INTO %s (%s) VALUES %s",
+			md.table, names(cols, "%s", ", "), strings.Join(rows, ", "))
+		if _, err := f.txm.ExecContext(ctx, f.txm.Rebind(query), args...); err != nil {
+			return fmt.Errorf("uow: failed to insert into %s: %w", md.table, err)
+		}
+	}
+	return nil
+}
+
+func (f *flusher) insertAuto(ctx context.Context, md *meta, cols []column, auto column, e Entity) error {
+	query := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)",
+		md.table, names(cols, "%s", ", "), placeholders(len(cols)))
+	if len(cols) == 0 {
+		query = fmt.Sprintf("INSERT INTO %s DEFAULT VALUES", md.table)
+	}
+	args := values(nil, e, cols)
+	if f.txm.Dialect().Returning() {
+		query += " RETURNING " + auto.name
+		err := f.txm.QueryRowxContext(ctx, f.txm.Rebind(query), args...).Scan(field(e, auto).Addr().Interface())
+		if err != nil {
+			return fmt.Errorf("uow: failed to insert into %s: %w", md.table, err)
+		}
+		return nil
+	}
+	result, err := f.txm.ExecContext(ctx, f.txm.Rebind(query), args...)
+	if err != nil {
+		return fmt.Errorf("uow: failed to insert into %s: %w", md.table, err)
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	return setID(e, auto, id)
+}
+
+func (f *flusher) update(ctx context.Context, g *group) error {
+	if len(g.updates) == 0 {
+		return nil
+	}
+	md := g.meta
+	pks, cols := md.pks(), md.updatable()
+	if len(pks) == 0 {
+		return fmt.Errorf("%w: %s", ErrNoPrimaryKey, md.table)
+	}
+	if len(cols) == 0 {
+		return nil
+	}
+	query := f.txm.Rebind(fmt.Sprintf("UPDATE %s SET %s WHERE %s",
+		md.table, names(cols, "%s = ?", ", "), names(pks, "%s = ?", " AND ")))
+	for _, e := range g.updates {
+		args := values(values(nil, e, cols), e, pks)
+		if _, err := f.txm.ExecContext(ctx, query, args...); err != nil {
+			return fmt.Errorf("uow: failed to update %s: %w", md.table, err)
+		}
+	}
+	return nil
+}
+
+func (f *flusher) delete(ctx context.Context, g *group) error {
+	if len(g.dels) == 0 {
+		return nil
+	}
+	md := g.meta
+	pks := md.pks()
+	switch len(pks) {
+	case 0:
+		return fmt.Errorf("%w: %s", ErrNoPrimaryKey, md.table)
+	case 1:
+		// Rows are deleted by IN if the primary key is not composite.
+		n := f.txm.Dialect().MaxParams()
+		for len(g.dels) > 0 {
+			chunk := g.dels
+			if len(chunk) > n {
+				chunk = chunk[:n]
+			}
+			g.dels = g.dels[len(chunk):]
+
+			args := make([]interface{}, 0, len(chunk))
+			for _, e := range chunk {
+				args = values(args, e, pks)
+			}
+			query := fmt.Sprintf("DELETE FROM %s WHERE %s IN (%s)",
+				md.table, pks[0].name, placeholders(len(chunk)))
+			if _, err := f.txm.ExecContext(ctx, f.txm.Rebind(query), args...); err != nil {
+				return fmt.Errorf("uow: failed to delete from %s: %w", md.table, err)
+			}
+		}
+		return nil
+	}
+	query := f.txm.Rebind(fmt.Sprintf("DELETE FROM %s WHERE %s",
+		md.table, names(pks, "%s = ?", " AND ")))
+	for _, e := range g.dels {
+		if _, err := f.txm.ExecContext(ctx, query, values(nil, e, pks)...); err != nil {
+			return fmt.Errorf("uow: failed to delete from %s: %w", md.table, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,200 @@
+package uow
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	sqlx "github.com/Code-Hex/sqlx-transactionmanager"
+	_ "github.com/mattn/go-sqlite3"
+)
+
+type Author struct {
+	ID   int64  `db:"id,auto"`
+	Name string `db:"name"`
+}
+
+func (*Author) TableName() string { return "author" }
+
+type Book struct {
+	ISBN     string `db:"isbn,pk"`
+	AuthorID int64  `db:"author_id"`
+	Title    string `db:"title"`
+}
+
+func (*Book) TableName() string   { return "book" }
+func (*Book) DependsOn() []string { return []string{"author"} }
+
+func openDB(t *testing.T) *sqlx.DB {
+	if os.Getenv("SQLX_SQLITE_DSN") == "skip" {
+		t.Skip("Disabling SQLite tests")
+	}
+	db := sqlx.MustOpen("sqlite3", filepath.Join(t.TempDir(), "uow.db")+"?_foreign_keys=1")
+	t.Cleanup(func() { db.Close() })
+	db.MustExec(`CREATE TABLE author (id integer PRIMARY KEY AUTOINCREMENT, name text NOT NULL)`)
+	db.MustExec(`CREATE TABLE book (isbn text PRIMARY KEY, author_id integer NOT NULL REFERENCES author (id), title text NOT NULL)`)
+	return db
+}
+
+func count(t *testing.T, db *sqlx.DB, query string, args ...interface{}) int {
+	var n int
+	if err := db.Get(&n, query, args...); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestFlushInDependencyOrder(t *testing.T) {
+	db := openDB(t)
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+
+	author := &Author{Name: "Code-Hex"}
+	u := From(tx)
+	// Books are registered first, but the author must be inserted first.
+	// 600 books are inserted over the limit of placeholders of sqlite.
+	books := make([]*Book, 600)
+	for i := range books {
+		// The first id of author table is 1.
+		books[i] = &Book{ISBN: strconv.Itoa(i), AuthorID: 1, Title: "sqlx"}
+		if err := u.RegisterNew(books[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := u.RegisterNew(author); err != nil {
+		t.Fatal(err)
+	}
+	if From(tx) != u {
+		t.Fatal("From must return the same unit of work in the transaction")
+	}
+
+	if count(t, db, "SELECT count(*) FROM book") != 0 {
+		t.Fatal("entities must not be written before commit")
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if author.ID != 1 {
+		t.Fatalf("id of author must be assigned, but got %d", author.ID)
+	}
+	if n := count(t, db, "SELECT count(*) FROM book WHERE author_id = ?", author.ID); n != len(books) {
+		t.Fatalf("expected %d books, but got %d", len(books), n)
+	}
+}
+
+func TestDirtyAndRemoved(t *testing.T) {
+	db := openDB(t)
+	db.MustExec("INSERT INTO author (id, name) VALUES (1, 'Code-Hex')")
+	db.MustExec("INSERT INTO book (isbn, author_id, title) VALUES ('1', 1, 'old'), ('2', 1, 'removed')")
+	ctx := context.Background()
+
+	tx := db.MustBeginTxm()
+	defer tx.Rollback()
+	u := From(tx)
+
+	author := &Author{ID: 1}
+	book := &Book{ISBN: "1", AuthorID: 1, Title: "new"}
+	removed := &Book{ISBN: "2"}
+	forgotten := &Book{ISBN: "3", AuthorID: 1, Title: "forgotten"}
+	if err := u.RegisterDirty(book); err != nil {
+		t.Fatal(err)
+	}
+	// The author is deleted after books which reference it.
+	if err := u.RegisterRemoved(author); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.RegisterRemoved(removed); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.RegisterNew(forgotten); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.RegisterRemoved(forgotten); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.RegisterDirty(removed); err != ErrRemoved {
+		t.Fatalf("expected ErrRemoved, but got %v", err)
+	}
+
+	if err := u.Flush(ctx); err == nil {
+		t.Fatal("author referenced by book must not be deleted")
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = db.MustBeginTxm()
+	defer tx.Rollback()
+	u = From(tx)
+	if err := u.RegisterDirty(book); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.RegisterRemoved(removed); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.RegisterNew(forgotten); err != nil {
+		t.Fatal(err)
+	}
+	if err := u.RegisterRemoved(forgotten); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "SELECT count(*) FROM book WHERE isbn = '1' AND title = 'new'"); n != 1 {
+		t.Fatal("dirty book must be updated")
+	}
+	if n := count(t, db, "SELECT count(*) FROM book"); n != 1 {
+		t.Fatalf("expected 1 book, but got %d", n)
+	}
+}
+
+func TestRollbackDiscardsChanges(t *testing.T) {
+	db := openDB(t)
+	tx := db.MustBeginTxm()
+	if err := From(tx).RegisterNew(&Author{Name: "Code-Hex"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+
+	tx = db.MustBeginTxm()
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := count(t, db, "SELECT count(*) FROM author"); n != 0 {
+		t.Fatalf("changes must be discarded by rollback, but got %d rows", n)
+	}
+}
+
+type traceKey struct{}
+
+func TestFlushWithContextOfTransaction(t *testing.T) {
+	db := openDB(t)
+	var traces []interface{}
+	db.Use(func(next sqlx.Handler) sqlx.Handler {
+		return func(ctx context.Context, s *sqlx.Statement) error {
+			traces = append(traces, ctx.Value(traceKey{}))
+			return next(ctx, s)
+		}
+	})
+
+	ctx := context.WithValue(context.Background(), traceKey{}, "request")
+	tx, err := db.BeginTxmx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := From(tx).RegisterNew(&Author{Name: "Code-Hex"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(traces) != 1 || traces[0] != "request" {
+		t.Fatalf("flush must use the context of the transaction: %v", traces)
+	}
+}
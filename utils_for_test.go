@@ -1,22 +1,41 @@
 package sqlx
 
 import (
+	"context"
 	"fmt"
-	"strings"
 	"testing"
+	"testing/fstest"
 
+	"github.com/Code-Hex/sqlx-transactionmanager/dialect"
+	"github.com/Code-Hex/sqlx-transactionmanager/fixtures"
+	"github.com/Code-Hex/sqlx-transactionmanager/migrate/split"
 	"github.com/jmoiron/sqlx"
 )
 
 // Stolen these codes from github.com/jmoiron/sqlx
 
+var defaultFixture = fstest.MapFS{
+	"default.yml": {Data: []byte(`
+person:
+  - {first_name: Jason, last_name: Moiron, email: jmoiron@jmoiron.net}
+  - {first_name: John, last_name: Doe, email: johndoeDNE@gmail.net}
+place:
+  - {country: United States, city: New York, telcode: 1}
+  - {country: Hong Kong, telcode: 852}
+  - {country: Singapore, telcode: 65}
+`)},
+}
+
 func loadDefaultFixture(db *DB, t *testing.T) {
+	f, err := fixtures.Load(defaultFixture)
+	if err != nil {
+		t.Fatal(err)
+	}
 	tx := db.MustBeginTxm()
-	tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "Jason", "Moiron", "jmoiron@jmoiron.net")
-	tx.MustExec(tx.Rebind("INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"), "John", "Doe", "johndoeDNE@gmail.net")
-	tx.MustExec(tx.Rebind("INSERT INTO place (country, city, telcode) VALUES (?, ?, ?)"), "United States", "New York", "1")
-	tx.MustExec(tx.Rebind("INSERT INTO place (country, telcode) VALUES (?, ?)"), "Hong Kong", "852")
-	tx.MustExec(tx.Rebind("INSERT INTO place (country, telcode) VALUES (?, ?)"), "Singapore", "65")
+	if err := f.Insert(context.Background(), tx); err != nil {
+		tx.Rollback()
+		t.Fatal(err)
+	}
 	tx.Commit()
 }
 
@@ -42,9 +61,14 @@ func RunWithSchema(schema Schema, t *testing.T, test func(db *DB, t *testing.T))
 }
 
 func MultiExec(e sqlx.Execer, query string) {
-	stmts := strings.Split(query, ";\n")
-	if len(strings.Trim(stmts[len(stmts)-1], " \n\t\r")) == 0 {
-		stmts = stmts[:len(stmts)-1]
+	d := dialect.For("")
+	if n, ok := e.(interface{ DriverName() string }); ok {
+		d = dialect.For(n.DriverName())
+	}
+	stmts, err := split.Statements(d, query)
+	if err != nil {
+		fmt.Println(err, query)
+		return
 	}
 	for _, s := range stmts {
 		_, err := e.Exec(s)
@@ -0,0 +1,189 @@
+package sqlx
+
+import (
+	"context"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// Threshold is the kind of threshold which is crossed by a transaction.
+type Threshold int
+
+// Thresholds which are watched by SetThresholds.
+const (
+	// SlowTransaction is crossed when the transaction is open
+	// longer than the threshold of total duration.
+	SlowTransaction Threshold = iota + 1
+	// IdleInTransaction is crossed when no statement is executed
+	// in the open transaction longer than the threshold of idle time.
+	IdleInTransaction
+)
+
+func (k Threshold) String() string {
+	switch k {
+	case SlowTransaction:
+		return "slow transaction"
+	case IdleInTransaction:
+		return "idle in transaction"
+	}
+	return "unknown threshold"
+}
+
+// ThresholdEvent is reported when a transaction crosses a threshold.
+type ThresholdEvent struct {
+	Kind Threshold
+	// TxID is the ID of the transaction. See (*Txm).ID.
+	TxID uint64
+	// Label is the label given by WithLabel when the transaction begins.
+	Label string
+	// Stack is the stack trace of the goroutine which began the transaction.
+	Stack   []byte
+	BeganAt time.Time
+	// Elapsed is the time since the transaction began for SlowTransaction,
+	// or since the last statement for IdleInTransaction.
+	Elapsed time.Duration
+	// LastQuery is the last statement executed in the transaction.
+	// It is empty if no statement is executed yet.
+	LastQuery string
+	LastAt    time.Time
+}
+
+type watchConfig struct {
+	slow, idle time.Duration
+	report     func(ThresholdEvent)
+}
+
+// SetThresholds sets thresholds of transactions which are begun after this.
+// report is called when a transaction is open longer than slow,
+// or no statement is executed in it longer than idle, e.g. while
+// the application is doing HTTP calls holding the transaction.
+// Zero disables each threshold. report is called on its own goroutine,
+// at most once for slow and once per idle period for idle.
+//
+// It is not safe to call SetThresholds concurrently with BeginTxm.
+func (db *DB) SetThresholds(slow, idle time.Duration, report func(ThresholdEvent)) {
+	if report == nil || (slow <= 0 && idle <= 0) {
+		db.watch = nil
+		return
+	}
+	db.watch = &watchConfig{slow: slow, idle: idle, report: report}
+}
+
+type labelKey struct{}
+
+// WithLabel returns a context which labels transactions begun with it,
+// so they can be told apart in ThresholdEvent.
+func WithLabel(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, labelKey{}, label)
+}
+
+// LabelFromContext returns the label given by WithLabel.
+func LabelFromContext(ctx context.Context) string {
+	label, _ := ctx.Value(labelKey{}).(string)
+	return label
+}
+
+// txID is the last ID of transactions.
+var txID uint64
+
+// ID returns the ID of the transaction, which is unique in the process.
+func (t *Txm) ID() uint64 {
+	return t.id
+}
+
+// Label returns the label given by WithLabel when the transaction begins.
+func (t *Txm) Label() string {
+	return t.label
+}
+
+// watcher watches thresholds of a transaction.
+type watcher struct {
+	cfg     *watchConfig
+	txID    uint64
+	label   string
+	stack   []byte
+	beganAt time.Time
+
+	mu     sync.Mutex
+	slow   *time.Timer
+	idle   *time.Timer
+	last   string
+	lastAt time.Time
+	busy   int
+	done   bool
+}
+
+func (t *Txm) startWatch(cfg *watchConfig) {
+	w := &watcher{
+		cfg:     cfg,
+		txID:    t.id,
+		label:   t.label,
+		stack:   debug.Stack(),
+		beganAt: time.Now(),
+	}
+	w.lastAt = w.beganAt
+	if cfg.slow > 0 {
+		w.slow = time.AfterFunc(cfg.slow, func() { w.fire(SlowTransaction) })
+	}
+	if cfg.idle > 0 {
+		w.idle = time.AfterFunc(cfg.idle, func() { w.fire(IdleInTransaction) })
+	}
+	t.watch = w
+	t.afterEnd = append(t.afterEnd, w.stop)
+}
+
+// statement marks the transaction busy until the returned func is called.
+func (w *watcher) statement(query string) func() {
+	w.mu.Lock()
+	w.busy++
+	if w.idle != nil {
+		w.idle.Stop()
+	}
+	w.mu.Unlock()
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		w.busy--
+		w.last, w.lastAt = query, time.Now()
+		if w.idle != nil && w.busy == 0 && !w.done {
+			w.idle.Reset(w.cfg.idle)
+		}
+	}
+}
+
+func (w *watcher) fire(kind Threshold) {
+	w.mu.Lock()
+	if w.done || (kind == IdleInTransaction && w.busy > 0) {
+		w.mu.Unlock()
+		return
+	}
+	e := ThresholdEvent{
+		Kind:      kind,
+		TxID:      w.txID,
+		Label:     w.label,
+		Stack:     w.stack,
+		BeganAt:   w.beganAt,
+		LastQuery: w.last,
+		LastAt:    w.lastAt,
+	}
+	w.mu.Unlock()
+	if kind == SlowTransaction {
+		e.Elapsed = time.Since(e.BeganAt)
+	} else {
+		e.Elapsed = time.Since(e.LastAt)
+	}
+	w.cfg.report(e)
+}
+
+func (w *watcher) stop() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.done = true
+	if w.slow != nil {
+		w.slow.Stop()
+	}
+	if w.idle != nil {
+		w.idle.Stop()
+	}
+}
@@ -0,0 +1,62 @@
+package sqlx
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestThresholds(t *testing.T) {
+	db := openInterceptedDB(t)
+	events := make(chan ThresholdEvent, 10)
+	db.SetThresholds(100*time.Millisecond, 30*time.Millisecond, func(e ThresholdEvent) {
+		events <- e
+	})
+
+	ctx := WithLabel(context.Background(), "signup")
+	tx, err := db.BeginTxmx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if tx.ID() == 0 || tx.Label() != "signup" {
+		t.Fatalf("unexpected transaction %d labeled %q", tx.ID(), tx.Label())
+	}
+	insert := "INSERT INTO person (first_name, last_name, email) VALUES (?, ?, ?)"
+	tx.MustExec(insert, "Code", "Hex", "x00.x7f@gmail.com")
+
+	// Hold the transaction like doing HTTP calls.
+	e := <-events
+	if e.Kind != IdleInTransaction {
+		t.Fatalf("expected %v, but got %v", IdleInTransaction, e.Kind)
+	}
+	if e.TxID != tx.ID() || e.Label != "signup" || e.LastQuery != insert || e.Elapsed < 30*time.Millisecond {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if !strings.Contains(string(e.Stack), "TestThresholds") {
+		t.Fatalf("stack must be of the goroutine which began the transaction:\n%s", e.Stack)
+	}
+	if e := <-events; e.Kind != SlowTransaction || e.Elapsed < 100*time.Millisecond {
+		t.Fatalf("unexpected event: %+v", e)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Thresholds are not watched after the transaction ends.
+	select {
+	case e := <-events:
+		t.Fatalf("unexpected event: %+v", e)
+	case <-time.After(150 * time.Millisecond):
+	}
+
+	// The label is not carried over to the next transaction.
+	tx = db.MustBeginTxm()
+	if tx.Label() != "" {
+		t.Fatalf("unexpected label %q", tx.Label())
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+}